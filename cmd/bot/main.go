@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/bot"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/client"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/config"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/tracing"
+)
+
+func main() {
+	count := flag.Int("count", 3, "number of bots to run")
+	strategy := flag.String("strategy", "mixed", "strategy every bot plays: random, aggressive, defensive, greedy or mixed to cycle through them")
+	think := flag.Duration("think", 2*time.Second, "average time a bot waits between commands")
+	seed := flag.Int64("seed", 0, "seed for bot decisions and war outcomes, 0 picks a random seed")
+	prefix := flag.String("prefix", "bot", "prefix for bot usernames")
+	game := flag.String("game", routing.DefaultGame, "game the bots join")
+	output := flag.String("output", "none", "how game events are shown: text, jsonl or none")
+	traceDest := flag.String("trace", "", "export trace spans to stdout or append them to a file, empty to not trace")
+	settings := config.Register(flag.CommandLine)
+	flag.Parse()
+
+	cfg, err := settings.Load()
+	if err != nil {
+		fmt.Printf("Error loading config: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if settings.PrintRequested() {
+		cfg.Print(os.Stdout)
+		return
+	}
+	cfg.Apply()
+	closeLog, err := cfg.SetupLogging(os.Stderr)
+	if err != nil {
+		fmt.Printf("Error setting up logging: %s\n", err.Error())
+		os.Exit(1)
+	}
+	defer closeLog()
+
+	shutdownTracing, err := tracing.Setup("peril-bot", *traceDest)
+	if err != nil {
+		fmt.Printf("Error setting up tracing: %s\n", err.Error())
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
+	strategies := bot.AllStrategies()
+	if *strategy != "mixed" {
+		s, err := bot.NewStrategy(*strategy)
+		if err != nil {
+			fmt.Printf("Error choosing strategy: %s\n", err.Error())
+			os.Exit(1)
+		}
+		strategies = []bot.Strategy{s}
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	fmt.Printf("Starting %d bot(s) with seed %d\n", *count, *seed)
+
+	factory, err := cfg.ConnFactory()
+	if err != nil {
+		fmt.Printf("Error setting up connection: %s\n", err.Error())
+		os.Exit(1)
+	}
+	conn, err := factory.Dial()
+	if err != nil {
+		fmt.Printf("Error connecting to rabbitmq: %s\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Println("Successfully connected to rabbitmq.")
+	defer conn.Close()
+
+	for i := range *count {
+		s := strategies[i%len(strategies)]
+		username := fmt.Sprintf("%s-%d-%s", *prefix, i+1, s.Name())
+		err := routing.ValidateUsername(username)
+		if err != nil {
+			fmt.Printf("Error naming bot: %s\n", err.Error())
+			os.Exit(1)
+		}
+		gs := gamelogic.NewGameState(username)
+		gs.SetGame(*game)
+		gs.SetSeed(*seed + int64(i))
+		presenter, err := gamelogic.NewPresenter(*output, os.Stdout, username)
+		if err != nil {
+			fmt.Printf("Error choosing output: %s\n", err.Error())
+			os.Exit(1)
+		}
+		gs.SetPresenter(presenter)
+
+		session, err := client.NewSession(conn, gs)
+		if err != nil {
+			fmt.Printf("Error creating session: %s\n", err.Error())
+			os.Exit(1)
+		}
+		defer session.Close()
+		err = session.Subscribe()
+		if err != nil {
+			fmt.Printf("Error subscribing to queue: %s\n", err.Error())
+			os.Exit(1)
+		}
+		go play(session, s, *think, rand.New(rand.NewSource(*seed+int64(i))))
+	}
+
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, os.Interrupt)
+	<-signalCh
+	fmt.Println("Shutting down...")
+}
+
+// play runs a bot until the game is over, waiting between half and one and
+// a half times the think time before each command.
+func play(session *client.Session, s bot.Strategy, think time.Duration, rng *rand.Rand) {
+	gs := session.GameState
+	for !gs.IsOver() {
+		time.Sleep(think/2 + time.Duration(rng.Int63n(int64(think)+1)))
+		if gs.IsPaused() {
+			continue
+		}
+		words := s.Next(bot.NewView(gs), rng)
+		if len(words) == 0 {
+			continue
+		}
+		var err error
+		switch words[0] {
+		case "move":
+			err = session.Move(words)
+		case "spawn":
+			err = session.Spawn(words)
+		default:
+			err = fmt.Errorf("unknown command %s", words[0])
+		}
+		if err != nil {
+			fmt.Printf("%s: error running %v: %s\n", gs.GetUsername(), words, err.Error())
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/client"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// runCommand runs one command typed by the player, writing any feedback to
+// out, and reports whether the player wants to quit.
+func runCommand(session *client.Session, words []string, out io.Writer) bool {
+	command := words[0]
+	if command == "quit" {
+		return true
+	}
+	if command == "help" {
+		gamelogic.WriteClientHelp(out)
+		return false
+	}
+	if command == "status" {
+		session.GameState.CommandStatus()
+		return false
+	}
+	if command == "spam" {
+		if len(words) < 2 {
+			fmt.Fprintln(out, "Usage: spam <number>")
+			return false
+		}
+		n, err := strconv.Atoi(words[1])
+		if err != nil {
+			fmt.Fprintf(out, "Number must be an integer: %s\n", words[1])
+			return false
+		}
+		for range n {
+			err := session.PublishGameLog(gamelogic.GetMaliciousLog())
+			if err != nil {
+				fmt.Fprintf(out, "Error publishing malicious log: %s\n", err.Error())
+			}
+		}
+		return false
+	}
+	if command == "move" {
+		err := session.Move(words)
+		if err != nil {
+			fmt.Fprintf(out, "Error moving: %s\n", err.Error())
+			return false
+		}
+		slog.Debug("published move")
+		return false
+	}
+	if command == "propose" || command == "accept" || command == "break" {
+		err := session.Diplomacy(words)
+		if err != nil {
+			fmt.Fprintf(out, "Error with diplomacy: %s\n", err.Error())
+		}
+		return false
+	}
+	if command == "say" || command == "whisper" {
+		err := session.Chat(words)
+		if err != nil {
+			fmt.Fprintf(out, "Error chatting: %s\n", err.Error())
+		}
+		return false
+	}
+	if command == "spawn" {
+		err := session.Spawn(words)
+		if err != nil {
+			fmt.Fprintf(out, "Error spawning: %s\n", err.Error())
+		}
+		return false
+	}
+	fmt.Fprintln(out, "Command not recognized.")
+	return false
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/console"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+var commands = []string{
+	"move", "spawn", "propose", "accept", "break", "say", "whisper",
+	"status", "spam", "quit", "help",
+}
+
+// completer completes commands and their arguments: locations, ranks, pacts,
+// chat channels, the player's own unit IDs and the players they know of.
+func completer(state func() *gamelogic.GameState) console.Completer {
+	return func(words []string, partial string) []string {
+		if len(words) == 0 {
+			return commands
+		}
+		gs := state()
+		if gs == nil {
+			return nil
+		}
+		switch words[0] {
+		case "move":
+			if len(words) == 1 {
+				return locations()
+			}
+			return unitIDs(gs, words[2:])
+		case "spawn":
+			switch len(words) {
+			case 1:
+				return locations()
+			case 2:
+				ranks := []string{}
+				for _, rank := range gamelogic.ListRanks() {
+					ranks = append(ranks, string(rank))
+				}
+				return ranks
+			}
+		case "propose":
+			switch len(words) {
+			case 1:
+				return knownPlayers(gs)
+			case 2:
+				pacts := []string{}
+				for _, pact := range gamelogic.ListPacts() {
+					pacts = append(pacts, string(pact))
+				}
+				return pacts
+			}
+		case "accept", "break", "whisper":
+			if len(words) == 1 {
+				return knownPlayers(gs)
+			}
+		case "say":
+			if len(words) == 1 {
+				return []string{routing.ChatGlobal, routing.ChatGame, routing.ChatAlliance}
+			}
+		}
+		return nil
+	}
+}
+
+func locations() []string {
+	locations := []string{}
+	for _, loc := range gamelogic.ListLocations() {
+		locations = append(locations, string(loc))
+	}
+	return locations
+}
+
+// unitIDs returns the IDs of the player's units that have not already been
+// typed.
+func unitIDs(gs *gamelogic.GameState, typed []string) []string {
+	skip := map[string]bool{}
+	for _, word := range typed {
+		skip[word] = true
+	}
+	ids := []string{}
+	for id := range gs.GetPlayerSnap().Units {
+		if !skip[strconv.Itoa(id)] {
+			ids = append(ids, strconv.Itoa(id))
+		}
+	}
+	return ids
+}
+
+// knownPlayers returns every player this player has seen or dealt with.
+func knownPlayers(gs *gamelogic.GameState) []string {
+	status := gs.Status()
+	players := []string{}
+	for _, s := range status.Sightings {
+		players = append(players, s.Username)
+	}
+	for _, rel := range status.Relations {
+		players = append(players, rel.Username)
+	}
+	return players
+}
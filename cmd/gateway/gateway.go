@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/client"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/config"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	"golang.org/x/net/websocket"
+)
+
+// gateway lets browsers play. Each WebSocket gets its own RabbitMQ
+// connection and client.Session, so a browser player subscribes and
+// publishes on exactly the same routing keys as the terminal client, and
+// their queues go away with the connection when they leave.
+//
+// The browser joins with /ws?username=<name>&game=<game> and is sent a
+// welcome message followed by every game event as the JSON lines
+// presenter writes them. It sends commands as
+//
+//	{"id": 1, "command": "move", "args": ["europe", "1"]}
+//
+// and gets a reply with the same id, carrying an error if the command
+// failed.
+type gateway struct {
+	factory *config.ConnFactory
+	combat  string
+	game    string
+}
+
+type request struct {
+	ID      int      `json:"id"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+}
+
+type reply struct {
+	Type  string `json:"type"`
+	ID    int    `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type welcome struct {
+	Type      string               `json:"type"`
+	Player    string               `json:"player"`
+	Game      string               `json:"game"`
+	Locations []gamelogic.Location `json:"locations"`
+	Ranks     []gamelogic.UnitRank `json:"ranks"`
+	Pacts     []gamelogic.PactType `json:"pacts"`
+}
+
+// checkOrigin only lets the gateway's own pages open a socket, so that
+// another site can't play from its visitors' browsers under names of its
+// choosing. Browsers always send the Origin header with a WebSocket
+// handshake.
+func checkOrigin(config *websocket.Config, req *http.Request) error {
+	origin, err := websocket.Origin(config, req)
+	if err != nil {
+		return err
+	}
+	if origin == nil || origin.Host != req.Host || (origin.Scheme != "http" && origin.Scheme != "https") {
+		return fmt.Errorf("error: origin %q may not open a socket", req.Header.Get("Origin"))
+	}
+	config.Origin = origin
+	return nil
+}
+
+func (g *gateway) serve(ws *websocket.Conn) {
+	defer ws.Close()
+	query := ws.Request().URL.Query()
+	username := query.Get("username")
+	game := query.Get("game")
+	if game == "" {
+		game = g.game
+	}
+	err := errors.Join(routing.ValidateUsername(username), routing.ValidateGame(game))
+	if err != nil {
+		websocket.JSON.Send(ws, reply{Type: "error", Error: err.Error()})
+		return
+	}
+
+	logger := slog.With("username", username, "game", game, "remote_addr", ws.Request().RemoteAddr)
+	session, closeSession, err := g.join(ws, username, game)
+	if err != nil {
+		logger.Warn("could not join", "err", err)
+		websocket.JSON.Send(ws, reply{Type: "error", Error: err.Error()})
+		return
+	}
+	defer closeSession()
+	logger.Info("joined")
+	defer logger.Info("left")
+
+	websocket.JSON.Send(ws, welcome{
+		Type:      "welcome",
+		Player:    username,
+		Game:      game,
+		Locations: gamelogic.ListLocations(),
+		Ranks:     gamelogic.ListRanks(),
+		Pacts:     gamelogic.ListPacts(),
+	})
+	session.GameState.CommandStatus()
+
+	for {
+		var msg []byte
+		err := websocket.Message.Receive(ws, &msg)
+		if err != nil {
+			return
+		}
+		var req request
+		err = json.Unmarshal(msg, &req)
+		if err != nil {
+			websocket.JSON.Send(ws, reply{Type: "reply", Error: "error: commands must be JSON objects"})
+			continue
+		}
+		res := reply{Type: "reply", ID: req.ID}
+		err = runCommand(session, req)
+		if err != nil {
+			res.Error = err.Error()
+		}
+		websocket.JSON.Send(ws, res)
+	}
+}
+
+// join connects a player to the broker and subscribes them to their
+// queues, with every event they see sent down ws.
+func (g *gateway) join(ws *websocket.Conn, username, game string) (*client.Session, func(), error) {
+	resolver, err := gamelogic.NewCombatResolver(g.combat)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := g.factory.Dial()
+	if err != nil {
+		return nil, nil, errors.New("error: the game server is not reachable")
+	}
+
+	gs := gamelogic.NewGameState(username)
+	gs.SetCombatResolver(resolver)
+	gs.SetGame(game)
+	gs.SetPresenter(gamelogic.NewJSONLinesPresenter(ws, username))
+	session, err := client.NewSession(conn, gs)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	err = session.Subscribe()
+	if err != nil {
+		session.Close()
+		conn.Close()
+		// The player's queues are exclusive, so this is almost always
+		// someone else playing under the same name.
+		return nil, nil, fmt.Errorf("error: could not join as %s, the name may be taken", username)
+	}
+	return session, func() {
+		session.Close()
+		conn.Close()
+	}, nil
+}
+
+// runCommand runs one command from the browser. The results show up as
+// events, so only failures are reported back.
+func runCommand(session *client.Session, req request) error {
+	words := append([]string{req.Command}, req.Args...)
+	switch req.Command {
+	case "status":
+		session.GameState.CommandStatus()
+		return nil
+	case "move":
+		return session.Move(words)
+	case "spawn":
+		return session.Spawn(words)
+	case "propose", "accept", "break":
+		return session.Diplomacy(words)
+	case "say", "whisper":
+		return session.Chat(words)
+	}
+	return fmt.Errorf("error: %s is not a valid command", req.Command)
+}
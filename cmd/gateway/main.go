@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/config"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/metrics"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/tracing"
+	"golang.org/x/net/websocket"
+)
+
+//go:embed static
+var static embed.FS
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to serve the web client and the WebSocket API on")
+	combat := flag.String("combat", "sum", "combat resolver used for wars browser players fight: sum or dice")
+	game := flag.String("game", routing.DefaultGame, "game browser players join unless they pick another")
+	metricsAddr := flag.String("metrics-addr", "", "address to serve Prometheus metrics on at /metrics, empty to not serve them")
+	traceDest := flag.String("trace", "", "export trace spans to stdout or append them to a file, empty to not trace")
+	settings := config.Register(flag.CommandLine)
+	flag.Parse()
+
+	cfg, err := settings.Load()
+	if err != nil {
+		fmt.Printf("Error loading config: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if settings.PrintRequested() {
+		cfg.Print(os.Stdout)
+		return
+	}
+	cfg.Apply()
+	closeLog, err := cfg.SetupLogging(os.Stderr)
+	if err != nil {
+		fmt.Printf("Error setting up logging: %s\n", err.Error())
+		os.Exit(1)
+	}
+	defer closeLog()
+
+	shutdownTracing, err := tracing.Setup("peril-gateway", *traceDest)
+	if err != nil {
+		fmt.Printf("Error setting up tracing: %s\n", err.Error())
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
+	_, err = gamelogic.NewCombatResolver(*combat)
+	if err != nil {
+		fmt.Printf("Error choosing combat resolver: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	factory, err := cfg.ConnFactory()
+	if err != nil {
+		fmt.Printf("Error setting up connection: %s\n", err.Error())
+		os.Exit(1)
+	}
+	g := &gateway{
+		factory: factory,
+		combat:  *combat,
+		game:    *game,
+	}
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		fmt.Printf("Error loading the web client: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if *metricsAddr != "" {
+		metrics.Serve(*metricsAddr)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServerFS(files))
+	mux.Handle("/ws", websocket.Server{Handler: g.serve, Handshake: checkOrigin})
+
+	fmt.Printf("Serving the Peril web client on %s\n", *addr)
+	err = http.ListenAndServe(*addr, mux)
+	if err != nil {
+		fmt.Printf("Error serving: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
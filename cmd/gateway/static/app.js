@@ -0,0 +1,172 @@
+// The Peril web client. Everything the player sees comes from events sent
+// by the gateway; the world, units and pacts are redrawn from every status
+// event, and a status is asked for after anything that may have changed.
+
+const $ = (id) => document.getElementById(id);
+
+let socket = null;
+let nextID = 1;
+let info = null;
+let state = null;
+
+$("join").addEventListener("submit", (e) => {
+  e.preventDefault();
+  const params = new URLSearchParams({ username: $("username").value.trim() });
+  if ($("game").value.trim()) {
+    params.set("game", $("game").value.trim());
+  }
+  const scheme = location.protocol === "https:" ? "wss:" : "ws:";
+  socket = new WebSocket(`${scheme}//${location.host}/ws?${params}`);
+  socket.onmessage = (msg) => receive(JSON.parse(msg.data));
+  socket.onclose = () => {
+    addFeed("Disconnected.", true);
+    $("join").classList.remove("hidden");
+  };
+});
+
+$("commands").addEventListener("submit", (e) => {
+  e.preventDefault();
+  const words = $("command").value.trim().split(/\s+/).filter((w) => w);
+  if (words.length === 0) {
+    return;
+  }
+  send(words[0], words.slice(1));
+  $("command").value = "";
+});
+
+function send(command, args) {
+  socket.send(JSON.stringify({ id: nextID++, command, args }));
+}
+
+function receive(msg) {
+  switch (msg.type) {
+    case "welcome":
+      info = msg;
+      $("join").classList.add("hidden");
+      $("playing").classList.remove("hidden");
+      addFeed(`Welcome, ${msg.player}! You are playing ${msg.game}.`);
+      return;
+    case "error":
+      addFeed(msg.error, true);
+      return;
+    case "reply":
+      if (msg.error) {
+        addFeed(msg.error, true);
+      }
+      return;
+    case "status":
+      state = msg.event;
+      draw();
+      return;
+  }
+  const line = describe(msg.type, msg.event);
+  if (line) {
+    addFeed(line);
+  }
+  send("status", []);
+}
+
+function describe(type, e) {
+  switch (type) {
+    case "paused":
+      return e.Paused ? "The game is paused." : "The game has resumed.";
+    case "move_detected":
+      if (e.Outcome === "same_player") {
+        return "";
+      }
+      return `${e.Move.Username} moved ${e.Move.Units.length} unit(s) to ${e.Move.ToLocation}` +
+        (e.Outcome === "make_war" ? ", war!" : e.Pact ? `, kept at peace by your ${e.Pact}` : "");
+    case "moved":
+      return `You moved ${e.Move.Units.length} unit(s) to ${e.Move.ToLocation}`;
+    case "spawned":
+      return `You spawned a(n) ${e.Unit.Rank} in ${e.Unit.Location} with id ${e.Unit.ID}`;
+    case "war_fought":
+      if (e.Outcome === "not_involved") {
+        return "";
+      }
+      if (e.Outcome === "no_units") {
+        return `Your war with ${e.Defender} was called off, no units met`;
+      }
+      return `War! ${describeWar(e.Result)}`;
+    case "war_result":
+      return `${e.Result.Attacker} attacked you! ${describeWar(e.Result)}`;
+    case "diplomacy_sent":
+      return `You ${e.Diplomacy.Action} a ${e.Diplomacy.Pact} with ${e.Diplomacy.To}`;
+    case "diplomacy_received":
+      return `${e.Diplomacy.From} wants to ${e.Diplomacy.Action} a ${e.Diplomacy.Pact}` +
+        (e.Ignored ? " (ignored)" : "");
+    case "chat": {
+      const channel = e.Message.Game || e.Message.Channel;
+      return `[${channel}] ${e.Message.From}: ${e.Message.Text}`;
+    }
+    case "game_over":
+      return e.Won ? "The game is over. You won!" : `The game is over. ${e.Over.Winner || "Nobody"} won: ${e.Over.Reason}`;
+    case "kicked":
+      return "The server removed you from the game" + (e.Kick.Reason ? `: ${e.Kick.Reason}` : ".");
+  }
+  return "";
+}
+
+function describeWar(r) {
+  if (r.Draw) {
+    return `${r.Location}: ${r.Attacker} and ${r.Defender} drew ${r.AttackerPower}-${r.DefenderPower}`;
+  }
+  const [won, lost] = r.Winner === r.Attacker ? [r.AttackerPower, r.DefenderPower] : [r.DefenderPower, r.AttackerPower];
+  return `${r.Location}: ${r.Winner} beat ${r.Loser} ${won}-${lost}`;
+}
+
+function addFeed(text, error) {
+  const feed = $("feed");
+  const line = document.createElement("div");
+  line.textContent = `${new Date().toLocaleTimeString()} ${text}`;
+  if (error) {
+    line.className = "error";
+  }
+  feed.appendChild(line);
+  while (feed.childNodes.length > 500) {
+    feed.removeChild(feed.firstChild);
+  }
+  feed.scrollTop = feed.scrollHeight;
+}
+
+function draw() {
+  const units = Object.values(state.Player.Units || {}).sort((a, b) => a.ID - b.ID);
+  const phase = state.Over ? "GAME OVER" : state.Paused ? "PAUSED" : "RUNNING";
+  $("title").textContent = `Peril | ${state.Player.Username} | ${units.length} unit(s) | ${phase}`;
+
+  const own = {};
+  for (const unit of units) {
+    own[unit.Location] = (own[unit.Location] || 0) + 1;
+  }
+  const enemies = {};
+  for (const s of state.Sightings || []) {
+    enemies[s.Unit.Location] = enemies[s.Unit.Location] || {};
+    enemies[s.Unit.Location][s.Username] = (enemies[s.Unit.Location][s.Username] || 0) + 1;
+  }
+  fill($("world"), (info ? info.locations : []).map((loc) => {
+    const parts = own[loc] ? [`you:${own[loc]}`] : [];
+    for (const [name, n] of Object.entries(enemies[loc] || {}).sort()) {
+      parts.push(`${name}:${n}`);
+    }
+    return { cells: [loc, parts.join(" ")], contested: own[loc] && enemies[loc] };
+  }));
+  fill($("units"), units.map((u) => ({ cells: [`#${u.ID}`, u.Rank, u.Location] })));
+  fill($("pacts"), (state.Relations || []).map((r) => ({
+    cells: [r.Username, r.Pact, r.Active ? "active" : `proposed by ${r.ProposedBy}`],
+  })));
+}
+
+function fill(table, rows) {
+  table.replaceChildren(...rows.map((row) => {
+    const tr = document.createElement("tr");
+    if (row.contested) {
+      tr.className = "contested";
+    }
+    for (const text of row.cells) {
+      const td = document.createElement("td");
+      td.textContent = text;
+      tr.appendChild(td);
+    }
+    return tr;
+  }));
+}
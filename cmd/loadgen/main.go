@@ -0,0 +1,401 @@
+// Command loadgen simulates many virtual players publishing moves, wars and
+// game logs and measures how long each message takes to go from publish to
+// being decoded by a consumer.
+//
+// Messages go through the game's exchanges with the same shapes as real
+// traffic, but under routing keys starting with a namespace of their own
+// (loadgen.army_moves.<username> and so on), so that none of the server's or
+// clients' bindings match them and a broker hosting a game can be loaded
+// without disturbing it.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/config"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/membus"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// sentAtHeader carries the publish time in nanoseconds since the epoch. The
+// AMQP timestamp property only has second precision.
+const sentAtHeader = "x-sent-at"
+
+// kind is one type of message the load generator publishes.
+type kind struct {
+	name     string
+	exchange string
+	prefix   string
+	rate     float64
+	publish  func(pub pubsub.Publisher, key string, username string, players int, rng *rand.Rand) error
+	decode   func(body []byte) error
+}
+
+func main() {
+	brokerName := flag.String("broker", "memory", "broker to load: memory for the in-process bus or amqp for RabbitMQ")
+	players := flag.Int("players", 1000, "number of virtual players")
+	duration := flag.Duration("duration", 10*time.Second, "how long to publish for")
+	drain := flag.Duration("drain", 5*time.Second, "how long to wait for consumers to catch up after publishing stops")
+	fanout := flag.Int("fanout", 1, "number of consumer queues bound to each kind of message")
+	moveRate := flag.Float64("moves", 200, "army moves published per second")
+	warRate := flag.Float64("wars", 20, "recognitions of war published per second")
+	logRate := flag.Float64("logs", 100, "game logs published per second")
+	seed := flag.Int64("seed", 1, "seed for generated messages")
+	jsonPath := flag.String("json", "", "also write the report as JSON to this file, - for stdout")
+	namespace := flag.String("namespace", "loadgen", "first word of every routing key and queue name, so that runs sharing a broker keep apart")
+	settings := config.Register(flag.CommandLine)
+	flag.Parse()
+
+	cfg, err := settings.Load()
+	if err != nil {
+		fmt.Printf("Error loading config: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if settings.PrintRequested() {
+		cfg.Print(os.Stdout)
+		return
+	}
+	cfg.Apply()
+	closeLog, err := cfg.SetupLogging(os.Stderr)
+	if err != nil {
+		fmt.Printf("Error setting up logging: %s\n", err.Error())
+		os.Exit(1)
+	}
+	defer closeLog()
+
+	kinds := []kind{
+		{
+			name:     "moves",
+			exchange: routing.ExchangePerilTopic,
+			prefix:   routing.ArmyMovesPrefix,
+			rate:     *moveRate,
+			publish:  publishMove,
+			decode:   decodeJSON[gamelogic.ArmyMove],
+		},
+		{
+			name:     "wars",
+			exchange: routing.ExchangePerilTopic,
+			prefix:   routing.WarRecognitionsPrefix,
+			rate:     *warRate,
+			publish:  publishWar,
+			decode:   decodeJSON[gamelogic.RecognitionOfWar],
+		},
+		{
+			name:     "logs",
+			exchange: routing.ExchangePerilTopic,
+			prefix:   routing.GameLogSlug,
+			rate:     *logRate,
+			publish:  publishLog,
+			decode:   decodeGob[routing.GameLog],
+		},
+	}
+
+	var b broker
+	switch *brokerName {
+	case "memory":
+		b = newMemoryBroker()
+	case "amqp":
+		var factory *config.ConnFactory
+		factory, err = cfg.ConnFactory()
+		if err == nil {
+			b, err = newAMQPBroker(factory)
+		}
+	default:
+		err = fmt.Errorf("%s is not a valid broker", *brokerName)
+	}
+	if err == nil && (*namespace == "" || strings.ContainsAny(*namespace, " \t.*#")) {
+		err = fmt.Errorf("%s is not a valid namespace", *namespace)
+	}
+	if err != nil {
+		fmt.Printf("Error setting up broker: %s\n", err.Error())
+		os.Exit(1)
+	}
+	defer b.Close()
+
+	recorders := map[string]*recorder{}
+	consumers := &sync.WaitGroup{}
+	for i := range kinds {
+		kinds[i].prefix = *namespace + "." + kinds[i].prefix
+	}
+	for _, k := range kinds {
+		rec := newRecorder(k.name)
+		recorders[k.name] = rec
+		for i := range *fanout {
+			deliveries, err := b.Consume(fmt.Sprintf("%s.%s.%d", *namespace, k.name, i), k.exchange, k.prefix+".*")
+			if err != nil {
+				fmt.Printf("Error consuming: %s\n", err.Error())
+				os.Exit(1)
+			}
+			consumers.Add(1)
+			go func() {
+				defer consumers.Done()
+				consume(deliveries, k, rec)
+			}()
+		}
+	}
+
+	fmt.Printf("Publishing for %v as %d players...\n", *duration, *players)
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+	publishers := &sync.WaitGroup{}
+	start := time.Now()
+	for i, k := range kinds {
+		pub, err := b.Publisher()
+		if err != nil {
+			fmt.Printf("Error creating publisher: %s\n", err.Error())
+			os.Exit(1)
+		}
+		publishers.Add(1)
+		go func() {
+			defer publishers.Done()
+			generate(ctx, k, stamp{pub}, *players, rand.New(rand.NewSource(*seed+int64(i))), recorders[k.name])
+		}()
+	}
+	publishers.Wait()
+	published := time.Since(start)
+
+	deadline := time.Now().Add(*drain)
+	for time.Now().Before(deadline) && !caughtUp(recorders, *fanout) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	report := Report{
+		Broker:   *brokerName,
+		Players:  *players,
+		Fanout:   *fanout,
+		Duration: published.Seconds(),
+	}
+	for _, k := range kinds {
+		report.Kinds = append(report.Kinds, recorders[k.name].report(published, *fanout))
+	}
+	report.WriteText(os.Stdout)
+	if *jsonPath != "" {
+		err := writeJSON(*jsonPath, report)
+		if err != nil {
+			fmt.Printf("Error writing JSON report: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
+// generate publishes messages of one kind at its configured rate until ctx
+// is done. Messages are sent in small batches every tick so that rates far
+// above the timer resolution still come out right.
+func generate(ctx context.Context, k kind, pub pubsub.Publisher, players int, rng *rand.Rand, rec *recorder) {
+	if k.rate <= 0 {
+		return
+	}
+	const tick = 10 * time.Millisecond
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	due := 0.0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		due += k.rate * tick.Seconds()
+		for ; due >= 1; due-- {
+			username := playerName(rng.Intn(players))
+			err := k.publish(pub, k.prefix+"."+username, username, players, rng)
+			rec.published.Add(1)
+			if err != nil {
+				rec.publishErrors.Add(1)
+			}
+		}
+	}
+}
+
+// consume only acks messages the load generator sent: anything without its
+// header or that does not decode is counted as an error and discarded.
+func consume(deliveries <-chan amqp.Delivery, k kind, rec *recorder) {
+	for d := range deliveries {
+		sentAt, ok := d.Headers[sentAtHeader].(int64)
+		if !ok {
+			rec.decodeErrors.Add(1)
+			d.Nack(false, false)
+			continue
+		}
+		if err := k.decode(d.Body); err != nil {
+			rec.decodeErrors.Add(1)
+			d.Nack(false, false)
+			continue
+		}
+		d.Ack(false)
+		rec.observe(time.Since(time.Unix(0, sentAt)))
+	}
+}
+
+func caughtUp(recorders map[string]*recorder, fanout int) bool {
+	for _, rec := range recorders {
+		if rec.received.Load()+rec.decodeErrors.Load() < (rec.published.Load()-rec.publishErrors.Load())*int64(fanout) {
+			return false
+		}
+	}
+	return true
+}
+
+// stamp adds the publish time to every message so consumers can work out
+// how long it took to arrive.
+type stamp struct {
+	pubsub.Publisher
+}
+
+func (s stamp) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[sentAtHeader] = time.Now().UnixNano()
+	msg.Headers = headers
+	return s.Publisher.PublishWithContext(ctx, exchange, key, mandatory, immediate, msg)
+}
+
+func playerName(i int) string {
+	return fmt.Sprintf("vp-%d", i)
+}
+
+func randomUnits(rng *rand.Rand, n int, loc gamelogic.Location) map[int]gamelogic.Unit {
+	ranks := gamelogic.ListRanks()
+	units := map[int]gamelogic.Unit{}
+	for i := range n {
+		units[i+1] = gamelogic.Unit{
+			ID:       i + 1,
+			Rank:     ranks[rng.Intn(len(ranks))],
+			Location: loc,
+		}
+	}
+	return units
+}
+
+func randomLocation(rng *rand.Rand) gamelogic.Location {
+	locations := gamelogic.ListLocations()
+	return locations[rng.Intn(len(locations))]
+}
+
+func publishMove(pub pubsub.Publisher, key string, username string, players int, rng *rand.Rand) error {
+	loc := randomLocation(rng)
+	move := gamelogic.ArmyMove{
+		Username:   username,
+		ToLocation: loc,
+	}
+	for _, unit := range randomUnits(rng, 1+rng.Intn(3), loc) {
+		move.Units = append(move.Units, unit)
+	}
+	return pubsub.PublishJSON(pub, routing.ExchangePerilTopic, key, move)
+}
+
+func publishWar(pub pubsub.Publisher, key string, username string, players int, rng *rand.Rand) error {
+	loc := randomLocation(rng)
+	return pubsub.PublishJSON(pub, routing.ExchangePerilTopic, key, gamelogic.RecognitionOfWar{
+		Attacker: gamelogic.Player{
+			Username: username,
+			Units:    randomUnits(rng, 1+rng.Intn(5), loc),
+		},
+		Defender: gamelogic.Player{
+			Username: playerName(rng.Intn(players)),
+			Units:    randomUnits(rng, 1+rng.Intn(5), loc),
+		},
+	})
+}
+
+func publishLog(pub pubsub.Publisher, key string, username string, players int, rng *rand.Rand) error {
+	return pubsub.PublishGob(pub, routing.ExchangePerilTopic, key, routing.GameLog{
+		Username:    username,
+		Message:     gamelogic.GetMaliciousLog(),
+		CurrentTime: time.Now(),
+	})
+}
+
+func decodeJSON[T any](body []byte) error {
+	var msg T
+	return json.Unmarshal(body, &msg)
+}
+
+func decodeGob[T any](body []byte) error {
+	var msg T
+	return gob.NewDecoder(bytes.NewReader(body)).Decode(&msg)
+}
+
+func writeJSON(path string, report Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// broker hides whether the load generator talks to RabbitMQ or to the
+// in-process bus.
+type broker interface {
+	Publisher() (pubsub.Publisher, error)
+	Consume(queueName, exchange, key string) (<-chan amqp.Delivery, error)
+	Close() error
+}
+
+type memoryBroker struct {
+	bus *membus.Bus
+}
+
+func newMemoryBroker() *memoryBroker {
+	return &memoryBroker{bus: membus.New()}
+}
+
+func (b *memoryBroker) Publisher() (pubsub.Publisher, error) {
+	return b.bus, nil
+}
+
+func (b *memoryBroker) Consume(queueName, exchange, key string) (<-chan amqp.Delivery, error) {
+	return b.bus.Deliveries(exchange, queueName, key, pubsub.Transient)
+}
+
+func (b *memoryBroker) Close() error {
+	return b.bus.Close()
+}
+
+type amqpBroker struct {
+	conn *amqp.Connection
+}
+
+func newAMQPBroker(factory *config.ConnFactory) (*amqpBroker, error) {
+	conn, err := factory.Dial()
+	if err != nil {
+		return nil, err
+	}
+	return &amqpBroker{conn: conn}, nil
+}
+
+func (b *amqpBroker) Publisher() (pubsub.Publisher, error) {
+	return b.conn.Channel()
+}
+
+func (b *amqpBroker) Consume(queueName, exchange, key string) (<-chan amqp.Delivery, error) {
+	ch, q, err := pubsub.DeclareAndBind(b.conn, exchange, queueName, key, pubsub.Transient)
+	if err != nil {
+		return nil, err
+	}
+	return ch.Consume(q.Name, "", false, false, false, false, nil)
+}
+
+func (b *amqpBroker) Close() error {
+	return b.conn.Close()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// recorder collects the counters and latencies of one kind of message.
+type recorder struct {
+	name          string
+	published     atomic.Int64
+	publishErrors atomic.Int64
+	received      atomic.Int64
+	decodeErrors  atomic.Int64
+	latencies     *histogram
+	mu            *sync.Mutex
+}
+
+func newRecorder(name string) *recorder {
+	return &recorder{
+		name:      name,
+		latencies: &histogram{},
+		mu:        &sync.Mutex{},
+	}
+}
+
+func (r *recorder) observe(latency time.Duration) {
+	r.received.Add(1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latencies.observe(latency)
+}
+
+// Latencies are counted in a fixed set of buckets, so a long run takes no
+// more memory than a short one. Each bucket is histogramGrowth times wider
+// than the one before, starting at histogramMin, which keeps percentiles
+// within 5% of the true value from a microsecond to several minutes.
+const (
+	histogramMin     = time.Microsecond
+	histogramGrowth  = 1.05
+	histogramBuckets = 400
+)
+
+type histogram struct {
+	counts [histogramBuckets]int64
+	count  int64
+	total  time.Duration
+	max    time.Duration
+}
+
+func (h *histogram) observe(d time.Duration) {
+	h.counts[bucketOf(d)]++
+	h.count++
+	h.total += d
+	h.max = max(h.max, d)
+}
+
+// bucketOf returns the bucket d falls in. Anything below histogramMin goes
+// in the first bucket and anything past the last one in the last.
+func bucketOf(d time.Duration) int {
+	if d < histogramMin {
+		return 0
+	}
+	i := int(math.Log(float64(d)/float64(histogramMin)) / math.Log(histogramGrowth))
+	return min(i, histogramBuckets-1)
+}
+
+// bucketTop returns the upper bound of bucket i.
+func bucketTop(i int) time.Duration {
+	return time.Duration(float64(histogramMin) * math.Pow(histogramGrowth, float64(i+1)))
+}
+
+// percentile returns the upper bound of the bucket holding the pth
+// latency, or the largest latency seen if that is lower.
+func (h *histogram) percentile(p float64) time.Duration {
+	rank := int64(float64(h.count-1)*p) + 1
+	var seen int64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			return min(bucketTop(i), h.max)
+		}
+	}
+	return h.max
+}
+
+type Report struct {
+	Broker   string       `json:"broker"`
+	Players  int          `json:"players"`
+	Fanout   int          `json:"fanout"`
+	Duration float64      `json:"duration_seconds"`
+	Kinds    []KindReport `json:"kinds"`
+}
+
+type KindReport struct {
+	Name          string  `json:"name"`
+	Published     int64   `json:"published"`
+	PublishErrors int64   `json:"publish_errors"`
+	Expected      int64   `json:"expected"`
+	Received      int64   `json:"received"`
+	DecodeErrors  int64   `json:"decode_errors"`
+	Throughput    float64 `json:"throughput_per_second"`
+	MeanMs        float64 `json:"mean_ms"`
+	P50Ms         float64 `json:"p50_ms"`
+	P90Ms         float64 `json:"p90_ms"`
+	P99Ms         float64 `json:"p99_ms"`
+	P999Ms        float64 `json:"p999_ms"`
+	MaxMs         float64 `json:"max_ms"`
+}
+
+// report summarizes a recorder. Every message published without an error
+// is expected to be received once by each of the fanout consumers.
+func (r *recorder) report(elapsed time.Duration, fanout int) KindReport {
+	r.mu.Lock()
+	latencies := *r.latencies
+	r.mu.Unlock()
+
+	kr := KindReport{
+		Name:          r.name,
+		Published:     r.published.Load(),
+		PublishErrors: r.publishErrors.Load(),
+		Expected:      (r.published.Load() - r.publishErrors.Load()) * int64(fanout),
+		Received:      r.received.Load(),
+		DecodeErrors:  r.decodeErrors.Load(),
+		Throughput:    float64(r.received.Load()) / elapsed.Seconds(),
+	}
+	if latencies.count == 0 {
+		return kr
+	}
+	kr.MeanMs = millis(latencies.total / time.Duration(latencies.count))
+	kr.P50Ms = millis(latencies.percentile(0.50))
+	kr.P90Ms = millis(latencies.percentile(0.90))
+	kr.P99Ms = millis(latencies.percentile(0.99))
+	kr.P999Ms = millis(latencies.percentile(0.999))
+	kr.MaxMs = millis(latencies.max)
+	return kr
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (r Report) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "broker: %s, players: %d, fanout: %d, duration: %.1fs\n", r.Broker, r.Players, r.Fanout, r.Duration)
+	fmt.Fprintf(w, "%-6s %10s %10s %10s %8s %10s %9s %9s %9s %9s %9s\n",
+		"kind", "published", "received", "expected", "errors", "msg/s", "p50 ms", "p90 ms", "p99 ms", "p99.9 ms", "max ms")
+	for _, k := range r.Kinds {
+		fmt.Fprintf(w, "%-6s %10d %10d %10d %8d %10.1f %9.2f %9.2f %9.2f %9.2f %9.2f\n",
+			k.Name, k.Published, k.Received, k.Expected, k.PublishErrors+k.DecodeErrors, k.Throughput,
+			k.P50Ms, k.P90Ms, k.P99Ms, k.P999Ms, k.MaxMs)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/chat"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/referee"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// admin is the HTTP API for operating the server from scripts and
+// dashboards. Every request must carry the admin token as a bearer token.
+//
+//	POST /pause                       pause the game
+//	POST /resume                      resume the game
+//	GET  /players                     standings, with each player's game
+//	GET  /games                       the players known to be in each game
+//	GET  /players/{username}/units    a player's units
+//	POST /players/{username}/kick     remove a player, {"reason": "..."}; a server
+//	                                  that is not refereeing asks the referee to
+//	POST /announce                    send {"text": "..."} to global chat
+//	GET  /logs?lines=<n>              the end of the game log, 100 lines by default
+//	GET  /logs/search                 search the game log and its archives, newest
+//	                                  first, by player, since, until, text, offset
+//	                                  and limit
+type admin struct {
+	token      string
+	pub        pubsub.Publisher
+	ref        *referee.Referee
+	refereeing bool
+	players    *roster
+}
+
+func (a *admin) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /pause", a.handlePause(true))
+	mux.HandleFunc("POST /resume", a.handlePause(false))
+	mux.HandleFunc("GET /players", a.handlePlayers)
+	mux.HandleFunc("GET /games", a.handleGames)
+	mux.HandleFunc("GET /players/{username}/units", a.handleUnits)
+	mux.HandleFunc("POST /players/{username}/kick", a.handleKick)
+	mux.HandleFunc("POST /announce", a.handleAnnounce)
+	mux.HandleFunc("GET /logs", a.handleLogs)
+	mux.HandleFunc("GET /logs/search", a.handleSearchLogs)
+	return a.authorize(mux)
+}
+
+func (a *admin) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("error: a valid admin token is required"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *admin) handlePause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := publishPause(a.pub, paused)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"paused": paused})
+	}
+}
+
+type playerInfo struct {
+	routing.Standing
+	Game string `json:",omitempty"`
+}
+
+func (a *admin) handlePlayers(w http.ResponseWriter, r *http.Request) {
+	players := []playerInfo{}
+	for _, s := range a.ref.Tracker.Standings() {
+		players = append(players, playerInfo{
+			Standing: s,
+			Game:     a.players.gameOf(s.Username),
+		})
+	}
+	writeJSON(w, http.StatusOK, players)
+}
+
+type gameInfo struct {
+	Game    string
+	Players []string
+}
+
+func (a *admin) handleGames(w http.ResponseWriter, r *http.Request) {
+	games := []gameInfo{}
+	for game, usernames := range a.players.players() {
+		games = append(games, gameInfo{Game: game, Players: usernames})
+	}
+	sort.Slice(games, func(i, j int) bool {
+		return games[i].Game < games[j].Game
+	})
+	writeJSON(w, http.StatusOK, games)
+}
+
+func (a *admin) handleUnits(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+	units, ok := a.ref.Tracker.Units(username)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("error: %s has no units on the map", username))
+		return
+	}
+	writeJSON(w, http.StatusOK, units)
+}
+
+func (a *admin) handleKick(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+	var body struct {
+		Reason string
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if !a.refereeing {
+		err := referee.RequestKick(a.pub, username, body.Reason)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		a.players.remove(username)
+		writeJSON(w, http.StatusAccepted, map[string]any{"kicked": username, "requested": true})
+		return
+	}
+	known, err := a.ref.Kick(username, body.Reason)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	a.players.remove(username)
+	writeJSON(w, http.StatusOK, map[string]any{"kicked": username, "known": known})
+}
+
+func (a *admin) handleAnnounce(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Text string
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if strings.TrimSpace(body.Text) == "" {
+		writeError(w, http.StatusBadRequest, errors.New("error: an announcement needs some text"))
+		return
+	}
+	err := announce(a.pub, body.Text)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"announced": body.Text})
+}
+
+func (a *admin) handleLogs(w http.ResponseWriter, r *http.Request) {
+	n := 100
+	if s := r.URL.Query().Get("lines"); s != "" {
+		var err error
+		n, err = strconv.Atoi(s)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("error: %s is not a valid number of lines", s))
+			return
+		}
+	}
+	lines, err := gamelogic.TailLog(n)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lines)
+}
+
+func (a *admin) handleSearchLogs(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := gamelogic.LogQuery{
+		Username: params.Get("player"),
+		Text:     params.Get("text"),
+		Limit:    gamelogic.DefaultLogLimit,
+	}
+	now := time.Now()
+	var err error
+	if s := params.Get("since"); s != "" {
+		q.Since, err = gamelogic.ParseLogTime(s, now)
+	}
+	if s := params.Get("until"); s != "" && err == nil {
+		q.Until, err = gamelogic.ParseLogTime(s, now)
+	}
+	if s := params.Get("offset"); s != "" && err == nil {
+		q.Offset, err = strconv.Atoi(s)
+		if err != nil {
+			err = fmt.Errorf("error: %s is not a valid offset", s)
+		}
+	}
+	if s := params.Get("limit"); s != "" && err == nil {
+		q.Limit, err = strconv.Atoi(s)
+		if err != nil {
+			err = fmt.Errorf("error: %s is not a valid limit", s)
+		}
+	}
+	if err == nil {
+		err = q.Validate()
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := gamelogic.SearchLogs(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func publishPause(pub pubsub.Publisher, paused bool) error {
+	return pubsub.PublishJSON(pub, routing.ExchangePerilDirect, routing.PauseKey, routing.PlayingState{
+		IsPaused: paused,
+	})
+}
+
+// announce sends a message from the server to the global chat channel.
+// It skips the moderator: announcements are not rate limited or filtered.
+func announce(pub pubsub.Publisher, text string) error {
+	msg := routing.ChatMessage{
+		From:    routing.ServerUsername,
+		Channel: routing.ChatGlobal,
+		Text:    text,
+		SentAt:  time.Now(),
+	}
+	keys, err := chat.DeliveryKeys(msg)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err := pubsub.PublishJSON(pub, routing.ExchangePerilTopic, key, msg)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readJSON decodes the request body into v, answering with an error if it
+// can't. An empty body leaves v as it is.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error: could not read request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
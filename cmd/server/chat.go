@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/chat"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// handlerChat relays chat requests from clients to the channels they were
+// addressed to once the moderator has approved them. Rejected messages are
+// acked and the sender is told why in a whisper from the server. Messages
+// to a game channel tell the roster which game the sender is in. The
+// sender is the player named by the routing key, and messages claiming to
+// be from anyone else, the server included, are dropped.
+func handlerChat(mod *chat.Moderator, ch *amqp.Channel, players *roster) func(context.Context, routing.ChatMessage) pubsub.AckType {
+	return func(ctx context.Context, msg routing.ChatMessage) pubsub.AckType {
+		sender, ok := routing.KeyUsername(routing.ChatRequestsPrefix, pubsub.RoutingKey(ctx))
+		if !ok || sender == routing.ServerUsername || msg.From != sender {
+			slog.Warn("dropping chat message sent under another name", "routing_key", pubsub.RoutingKey(ctx), "claimed", msg.From)
+			return pubsub.NackDiscard
+		}
+		reviewed, err := mod.Review(msg)
+		if err != nil {
+			if !errors.Is(err, chat.ErrRateLimited) {
+				slog.Info("rejected chat message", "username", msg.From, "err", err)
+			}
+			notice := routing.ChatMessage{
+				From:       routing.ServerUsername,
+				Channel:    routing.ChatWhisper,
+				Recipients: []string{msg.From},
+				Text:       "Your message was not delivered: " + err.Error(),
+				SentAt:     time.Now(),
+			}
+			err = pubsub.PublishJSON(ch, routing.ExchangePerilTopic, routing.ChatPrefix+"."+routing.ChatWhisper+"."+msg.From, notice)
+			if err != nil {
+				slog.Error("could not publish chat notice", "username", msg.From, "err", err)
+			}
+			return pubsub.Ack
+		}
+		if reviewed.Game != "" {
+			players.join(reviewed.From, reviewed.Game)
+		}
+		keys, _ := chat.DeliveryKeys(reviewed)
+		for _, key := range keys {
+			err := pubsub.PublishJSON(ch, routing.ExchangePerilTopic, key, reviewed)
+			if err != nil {
+				slog.Error("could not publish chat message", "username", msg.From, "routing_key", key, "err", err)
+				return pubsub.NackRequeue
+			}
+		}
+		return pubsub.Ack
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/ratelimit"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var refusedLogsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "peril_game_logs_refused_total",
+	Help: "Game logs dead-lettered instead of written, by reason.",
+}, []string{"reason"})
+
+// logGuard stops players flooding the game log. Logs over a player's rate
+// limit are dead-lettered with the reason instead of being written, and
+// each one is a strike against the player, sent to the referee to count
+// along with the strikes from every other server. The player is the one
+// named by the routing key, never the one the log claims to be from, so
+// that nobody can dodge the limit by making up names or get someone else
+// kicked by using theirs.
+type logGuard struct {
+	limiter *ratelimit.Limiter
+	pub     pubsub.Publisher
+	// strike is false when strikes are not counted, to save sending them.
+	strike bool
+}
+
+// handlerGameLog writes each game log the guard lets through to sink and
+// settles it once it has been stored.
+func handlerGameLog(sink gamelogic.LogSink, guard *logGuard) func(context.Context, routing.GameLog, pubsub.Acker) {
+	return func(ctx context.Context, gl routing.GameLog, settle pubsub.Acker) {
+		sender, ok := routing.KeyUsername(routing.GameLogSlug, pubsub.RoutingKey(ctx))
+		if !ok || gl.Username != sender {
+			settle(guard.forged(ctx, sender, gl))
+			return
+		}
+		if !guard.limiter.Allow(sender) {
+			settle(guard.refuse(ctx, gl))
+			return
+		}
+		sink.Write(gl, func(err error) {
+			if err != nil {
+				slog.Error("could not write game log", "username", gl.Username, "err", err)
+				settle(pubsub.NackRequeue)
+				return
+			}
+			settle(pubsub.Ack)
+		})
+	}
+}
+
+// forged dead-letters a log that claims to be from someone other than the
+// player whose routing key it was published under.
+func (g *logGuard) forged(ctx context.Context, sender string, gl routing.GameLog) pubsub.AckType {
+	slog.Warn("refusing game log published under another player's name", "username", sender, "claimed", gl.Username)
+	return g.deadLetter(ctx, pubsub.RoutingKey(ctx), gl, "username_mismatch")
+}
+
+// refuse dead-letters a log over the rate limit and gives its sender a
+// strike. Only call it once the log's username has been checked.
+func (g *logGuard) refuse(ctx context.Context, gl routing.GameLog) pubsub.AckType {
+	ack := g.deadLetter(ctx, routing.GameLogSlug+"."+gl.Username, gl, "rate_limited")
+	if ack != pubsub.Ack {
+		return ack
+	}
+
+	slog.Debug("refused game log over the rate limit", "username", gl.Username)
+	if !g.strike {
+		return pubsub.Ack
+	}
+	err := pubsub.PublishJSONWithContext(ctx, g.pub, routing.ExchangePerilDirect, routing.StrikesKey, routing.Strike{
+		Username: gl.Username,
+		Reason:   "flooding the game log",
+		At:       time.Now(),
+	})
+	if err != nil {
+		slog.Error("could not send strike", "username", gl.Username, "err", err)
+	}
+	return pubsub.Ack
+}
+
+func (g *logGuard) deadLetter(ctx context.Context, key string, gl routing.GameLog, reason string) pubsub.AckType {
+	err := pubsub.DeadLetterGob(ctx, g.pub, key, gl, reason)
+	if err != nil {
+		slog.Error("could not dead-letter game log", "routing_key", key, "err", err)
+		return pubsub.NackRequeue
+	}
+	refusedLogsTotal.WithLabelValues(reason).Inc()
+	return pubsub.Ack
+}
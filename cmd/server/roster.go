@@ -0,0 +1,53 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// roster remembers which game each player is in. Moves and spawns don't
+// say which game they belong to, so a player's game is only known once
+// they have chatted in it.
+type roster struct {
+	games map[string]string
+	mu    *sync.Mutex
+}
+
+func newRoster() *roster {
+	return &roster{
+		games: map[string]string{},
+		mu:    &sync.Mutex{},
+	}
+}
+
+func (r *roster) join(username, game string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.games[username] = game
+}
+
+func (r *roster) remove(username string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.games, username)
+}
+
+func (r *roster) gameOf(username string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.games[username]
+}
+
+// players returns the players known to be in each game, sorted by name.
+func (r *roster) players() map[string][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	players := map[string][]string{}
+	for username, game := range r.games {
+		players[game] = append(players[game], username)
+	}
+	for _, usernames := range players {
+		sort.Strings(usernames)
+	}
+	return players
+}
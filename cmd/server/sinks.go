@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// sinkFlags collects -game-log-sink, which can be given more than once.
+type sinkFlags []string
+
+func (s *sinkFlags) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *sinkFlags) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// openSinks builds the game log pipeline, writing every log to each of
+// these sinks:
+//
+//	file                   the game log, batched and rotated
+//	jsonl:<path>           JSON lines appended to path, synced by -game-log-sync
+//	stdout                 the server's terminal, as text or with ?format=json
+//	amqp:<exchange>/<key>  JSON messages published to another exchange
+//
+// Any sink can be given ?player=<username> or ?match=<regexp> to only get
+// some of the logs, such as stdout?match=won+a+war for war results.
+func openSinks(specs []string, openers sinkOpeners, out io.Writer, conn *amqp.Connection) (gamelogic.LogSink, error) {
+	sinks := []gamelogic.LogSink{}
+	fail := func(err error) (gamelogic.LogSink, error) {
+		gamelogic.Fanout(sinks...).Close()
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		target, rawQuery, _ := strings.Cut(spec, "?")
+		if seen[target] {
+			return fail(fmt.Errorf("error: the %s game log sink is given twice", target))
+		}
+		seen[target] = true
+		params, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return fail(fmt.Errorf("error: %s is not a valid game log sink: %v", spec, err))
+		}
+		filter := gamelogic.LogFilter{Username: params.Get("player")}
+		if match := params.Get("match"); match != "" {
+			filter.Match, err = regexp.Compile(match)
+			if err != nil {
+				return fail(fmt.Errorf("error: %s is not a valid pattern: %v", match, err))
+			}
+		}
+
+		sink, err := openSink(target, params, openers, out, conn)
+		if err != nil {
+			return fail(err)
+		}
+		if filter != (gamelogic.LogFilter{}) {
+			sink = gamelogic.Filter(sink, filter)
+		}
+		sinks = append(sinks, sink)
+	}
+	return gamelogic.Fanout(sinks...), nil
+}
+
+// sinkOpeners open the sinks that write to disk, which share the game
+// log's settings.
+type sinkOpeners struct {
+	gameLog   func() (gamelogic.LogSink, error)
+	jsonLines func(path string) (gamelogic.LogSink, error)
+}
+
+func openSink(target string, params url.Values, openers sinkOpeners, out io.Writer, conn *amqp.Connection) (gamelogic.LogSink, error) {
+	kind, arg, _ := strings.Cut(target, ":")
+	switch kind {
+	case "file":
+		if arg != "" {
+			return nil, errors.New("error: the file sink writes to -log-path, it takes no path of its own")
+		}
+		return openers.gameLog()
+	case "jsonl":
+		if arg == "" {
+			return nil, errors.New("error: the jsonl sink needs a path, such as jsonl:game.jsonl")
+		}
+		return openers.jsonLines(arg)
+	case "stdout":
+		format := params.Get("format")
+		if format == "" {
+			format = "text"
+		}
+		return gamelogic.NewWriterSink(out, format)
+	case "amqp":
+		exchange, key, ok := strings.Cut(arg, "/")
+		if !ok || exchange == "" || key == "" {
+			return nil, errors.New("error: the amqp sink needs an exchange and routing key, such as amqp:logs/game_logs")
+		}
+		return newAMQPSink(conn, exchange, key)
+	}
+	return nil, fmt.Errorf("error: %s is not a valid game log sink", target)
+}
+
+// amqpSink forwards game logs as JSON so that other tools can consume them
+// without knowing gob. It has a channel of its own, because publishing to
+// an exchange that has been deleted closes the channel, and publishes in
+// confirm mode, so that a log is only done once the broker has it. Each
+// log waits for its confirm on its own, so that logs are not held up
+// waiting for the ones before them.
+type amqpSink struct {
+	ch       *amqp.Channel
+	pub      pubsub.Publisher
+	exchange string
+	key      string
+	inflight *sync.WaitGroup
+}
+
+func newAMQPSink(conn *amqp.Connection, exchange, key string) (gamelogic.LogSink, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	err = ch.ExchangeDeclarePassive(exchange, amqp.ExchangeTopic, true, false, false, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error: could not find exchange %s to forward game logs to: %v", exchange, err)
+	}
+	pub, err := pubsub.NewConfirmingPublisher(ch)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	return amqpSink{ch: ch, pub: pub, exchange: exchange, key: key, inflight: &sync.WaitGroup{}}, nil
+}
+
+func (s amqpSink) Write(gamelog routing.GameLog, done func(error)) {
+	s.inflight.Add(1)
+	go func() {
+		defer s.inflight.Done()
+		done(pubsub.PublishJSON(s.pub, s.exchange, s.key, gamelog))
+	}()
+}
+
+// Close waits for the logs being published to be confirmed.
+func (s amqpSink) Close() error {
+	s.inflight.Wait()
+	return s.ch.Close()
+}
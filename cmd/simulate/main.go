@@ -0,0 +1,49 @@
+// Command simulate plays the built-in simulation scenarios against an
+// in-memory bus and reports which of them ended the way they should.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/simulation"
+)
+
+func main() {
+	run := flag.String("run", "", "only run scenarios whose name contains this")
+	verbose := flag.Bool("v", false, "show every player's events as JSON lines and the message log")
+	flag.Parse()
+
+	logOut, level := io.Discard, slog.LevelError
+	if *verbose {
+		logOut, level = os.Stderr, slog.LevelDebug
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(logOut, &slog.HandlerOptions{Level: level})))
+
+	failed := 0
+	ran := 0
+	for _, sc := range simulation.Scenarios() {
+		if !strings.Contains(sc.Name, *run) {
+			continue
+		}
+		ran++
+		if *verbose {
+			sc.Options.Output = os.Stdout
+		}
+		err := sc.Run()
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %s: %s\n", sc.Name, err.Error())
+			continue
+		}
+		fmt.Printf("ok   %s\n", sc.Name)
+	}
+	fmt.Printf("%d of %d scenario(s) passed\n", ran-failed, ran)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"math/rand"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// Random spawns and moves units without any plan.
+type Random struct{}
+
+func (Random) Name() string {
+	return "random"
+}
+
+func (Random) Next(view View, rng *rand.Rand) []string {
+	units := view.units()
+	if len(units) == 0 || rng.Intn(3) == 0 {
+		return spawnWords(randomLocation(rng), randomRank(rng))
+	}
+	rng.Shuffle(len(units), func(i, j int) {
+		units[i], units[j] = units[j], units[i]
+	})
+	return moveWords(randomLocation(rng), units[:1+rng.Intn(len(units))])
+}
+
+// Aggressive builds a small army and then throws all of it at the most
+// recently seen enemy it hasn't already reached, exploring neighbouring
+// locations when there is none.
+type Aggressive struct{}
+
+func (Aggressive) Name() string {
+	return "aggressive"
+}
+
+func (Aggressive) Next(view View, rng *rand.Rand) []string {
+	home := view.strongestLocation()
+	if len(view.Player.Units) < 3 {
+		if home == "" {
+			home = randomLocation(rng)
+		}
+		return spawnWords(home, gamelogic.RankArtillery)
+	}
+	for _, sighting := range view.Sightings {
+		// Once the whole army is where the enemy was seen, the sighting
+		// is out of date, so it looks for the next one.
+		target := sighting.Unit.Location
+		if words := moveWords(target, view.unitsNotIn(target)); words != nil {
+			return words
+		}
+	}
+	neighbours := gamelogic.ListAdjacentLocations(home)
+	return moveWords(neighbours[rng.Intn(len(neighbours))], view.units())
+}
+
+// Defensive keeps its army in one place and reinforces it whenever the enemy
+// units it can see nearby outgun it.
+type Defensive struct{}
+
+func (Defensive) Name() string {
+	return "defensive"
+}
+
+func (Defensive) Next(view View, rng *rand.Rand) []string {
+	home := view.strongestLocation()
+	if home == "" {
+		return spawnWords(randomLocation(rng), gamelogic.RankInfantry)
+	}
+	if stragglers := view.unitsNotIn(home); len(stragglers) > 0 {
+		return moveWords(home, stragglers)
+	}
+	threat := gamelogic.UnitsToPowerLevel(view.enemiesIn(home))
+	for _, loc := range gamelogic.ListAdjacentLocations(home) {
+		threat += gamelogic.UnitsToPowerLevel(view.enemiesIn(loc))
+	}
+	if threat >= gamelogic.UnitsToPowerLevel(view.unitsIn(home)) {
+		return spawnWords(home, gamelogic.RankArtillery)
+	}
+	if rng.Intn(4) == 0 {
+		return spawnWords(home, gamelogic.RankInfantry)
+	}
+	return nil
+}
+
+// Greedy attacks the strongest enemy position it is sure to beat, comparing
+// power levels with UnitsToPowerLevel, and builds artillery otherwise.
+type Greedy struct{}
+
+func (Greedy) Name() string {
+	return "greedy"
+}
+
+func (Greedy) Next(view View, rng *rand.Rand) []string {
+	power := gamelogic.UnitsToPowerLevel(view.units())
+	target := gamelogic.Location("")
+	targetPower := 0
+	for _, loc := range gamelogic.ListLocations() {
+		enemyPower := gamelogic.UnitsToPowerLevel(view.enemiesIn(loc))
+		if enemyPower > targetPower && enemyPower < power {
+			target, targetPower = loc, enemyPower
+		}
+	}
+	if target != "" {
+		if words := moveWords(target, view.unitsNotIn(target)); words != nil {
+			return words
+		}
+	}
+	home := view.strongestLocation()
+	if home == "" {
+		home = randomLocation(rng)
+	}
+	return spawnWords(home, gamelogic.RankArtillery)
+}
@@ -0,0 +1,133 @@
+package bot
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+)
+
+// View is everything a bot knows when deciding what to do next: its own
+// army and the last known positions of enemy units.
+type View struct {
+	Player    gamelogic.Player
+	Sightings []gamelogic.Sighting
+}
+
+func NewView(gs *gamelogic.GameState) View {
+	return View{
+		Player:    gs.GetPlayerSnap(),
+		Sightings: gs.GetSightingsSnap(),
+	}
+}
+
+// Strategy decides a bot's next command. Commands are returned as the
+// words a human would type into the client, or nil to do nothing this turn.
+// All randomness must come from rng so that bots are reproducible.
+type Strategy interface {
+	Name() string
+	Next(view View, rng *rand.Rand) []string
+}
+
+func NewStrategy(name string) (Strategy, error) {
+	for _, s := range AllStrategies() {
+		if s.Name() == name {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("error: %s is not a valid strategy", name)
+}
+
+func AllStrategies() []Strategy {
+	return []Strategy{
+		Random{},
+		Aggressive{},
+		Defensive{},
+		Greedy{},
+	}
+}
+
+func spawnWords(loc gamelogic.Location, rank gamelogic.UnitRank) []string {
+	return []string{"spawn", string(loc), string(rank)}
+}
+
+func moveWords(loc gamelogic.Location, units []gamelogic.Unit) []string {
+	if len(units) == 0 {
+		return nil
+	}
+	words := []string{"move", string(loc)}
+	for _, unit := range units {
+		words = append(words, strconv.Itoa(unit.ID))
+	}
+	return words
+}
+
+// units returns the bot's units ordered by ID so that strategies behave the
+// same way for the same seed.
+func (v View) units() []gamelogic.Unit {
+	units := []gamelogic.Unit{}
+	for _, unit := range v.Player.Units {
+		units = append(units, unit)
+	}
+	sort.Slice(units, func(i, j int) bool {
+		return units[i].ID < units[j].ID
+	})
+	return units
+}
+
+// unitsNotIn returns the bot's units outside loc.
+func (v View) unitsNotIn(loc gamelogic.Location) []gamelogic.Unit {
+	units := []gamelogic.Unit{}
+	for _, unit := range v.units() {
+		if unit.Location != loc {
+			units = append(units, unit)
+		}
+	}
+	return units
+}
+
+// strongestLocation returns where the bot has the most power, or "" if it
+// has no units.
+func (v View) strongestLocation() gamelogic.Location {
+	best := gamelogic.Location("")
+	bestPower := -1
+	for _, loc := range gamelogic.ListLocations() {
+		power := gamelogic.UnitsToPowerLevel(v.unitsIn(loc))
+		if len(v.unitsIn(loc)) > 0 && power > bestPower {
+			best, bestPower = loc, power
+		}
+	}
+	return best
+}
+
+func (v View) unitsIn(loc gamelogic.Location) []gamelogic.Unit {
+	units := []gamelogic.Unit{}
+	for _, unit := range v.units() {
+		if unit.Location == loc {
+			units = append(units, unit)
+		}
+	}
+	return units
+}
+
+func (v View) enemiesIn(loc gamelogic.Location) []gamelogic.Unit {
+	units := []gamelogic.Unit{}
+	for _, s := range v.Sightings {
+		if s.Unit.Location == loc {
+			units = append(units, s.Unit)
+		}
+	}
+	return units
+}
+
+func randomLocation(rng *rand.Rand) gamelogic.Location {
+	locations := gamelogic.ListLocations()
+	return locations[rng.Intn(len(locations))]
+}
+
+func randomRank(rng *rand.Rand) gamelogic.UnitRank {
+	ranks := gamelogic.ListRanks()
+	return ranks[rng.Intn(len(ranks))]
+}
@@ -0,0 +1,107 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/ratelimit"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+const maxMessageLength = 280
+
+var ErrRateLimited = errors.New("you are sending messages too quickly")
+
+// DefaultWords is the word list used when the server isn't given one.
+var DefaultWords = []string{
+	"bastard",
+	"bloody",
+	"crap",
+	"damn",
+}
+
+// Moderator is the server-side gate every chat message passes through
+// before it is relayed to players.
+type Moderator struct {
+	limiter *ratelimit.Limiter
+	words   map[string]struct{}
+}
+
+func NewModerator(limiter *ratelimit.Limiter, words []string) *Moderator {
+	m := &Moderator{
+		limiter: limiter,
+		words:   map[string]struct{}{},
+	}
+	for _, w := range words {
+		m.words[strings.ToLower(w)] = struct{}{}
+	}
+	return m
+}
+
+// Review validates a message, applies the sender's rate limit and masks
+// any profanity in the text.
+func (m *Moderator) Review(msg routing.ChatMessage) (routing.ChatMessage, error) {
+	msg.Text = strings.TrimSpace(msg.Text)
+	if msg.Text == "" {
+		return routing.ChatMessage{}, errors.New("message is empty")
+	}
+	if len(msg.Text) > maxMessageLength {
+		return routing.ChatMessage{}, fmt.Errorf("message is longer than %d characters", maxMessageLength)
+	}
+	if _, err := DeliveryKeys(msg); err != nil {
+		return routing.ChatMessage{}, err
+	}
+	if !m.limiter.Allow(msg.From) {
+		return routing.ChatMessage{}, ErrRateLimited
+	}
+	msg.Text = m.mask(msg.Text)
+	return msg, nil
+}
+
+func (m *Moderator) mask(text string) string {
+	var out, word strings.Builder
+	flush := func() {
+		w := word.String()
+		if _, ok := m.words[strings.ToLower(w)]; ok {
+			w = strings.Repeat("*", len([]rune(w)))
+		}
+		out.WriteString(w)
+		word.Reset()
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			word.WriteRune(r)
+			continue
+		}
+		flush()
+		out.WriteRune(r)
+	}
+	flush()
+	return out.String()
+}
+
+// DeliveryKeys returns the routing keys on peril_topic a reviewed message
+// should be published to.
+func DeliveryKeys(msg routing.ChatMessage) ([]string, error) {
+	switch msg.Channel {
+	case routing.ChatGlobal:
+		return []string{routing.ChatPrefix + "." + routing.ChatGlobal}, nil
+	case routing.ChatGame:
+		if msg.Game == "" {
+			return nil, errors.New("game channel messages need a game")
+		}
+		return []string{routing.ChatPrefix + "." + routing.ChatGame + "." + msg.Game}, nil
+	case routing.ChatAlliance, routing.ChatWhisper:
+		if len(msg.Recipients) == 0 {
+			return nil, fmt.Errorf("%s messages need at least one recipient", msg.Channel)
+		}
+		keys := []string{}
+		for _, r := range msg.Recipients {
+			keys = append(keys, routing.ChatPrefix+"."+msg.Channel+"."+r)
+		}
+		return keys, nil
+	}
+	return nil, fmt.Errorf("%s is not a valid chat channel", msg.Channel)
+}
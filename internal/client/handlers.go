@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+func (s *Session) handlerPause() func(routing.PlayingState) pubsub.AckType {
+	return func(ps routing.PlayingState) pubsub.AckType {
+		s.GameState.HandlePause(ps)
+		return pubsub.Ack
+	}
+}
+
+func (s *Session) handlerMove() func(context.Context, gamelogic.ArmyMove) pubsub.AckType {
+	return func(ctx context.Context, move gamelogic.ArmyMove) pubsub.AckType {
+		gs := s.GameState
+		switch gs.HandleMove(move) {
+		case gamelogic.MoveOutComeSafe:
+			return pubsub.Ack
+		case gamelogic.MoveOutcomeMakeWar:
+			err := pubsub.PublishJSONWithContext(
+				ctx,
+				s.pub,
+				routing.ExchangePerilTopic,
+				routing.WarRecognitionsPrefix+"."+gs.GetUsername(),
+				gs.DeclareWar(move),
+			)
+			if err != nil {
+				slog.Error("could not publish war recognition", "attacker", move.Username, "err", err)
+				return pubsub.NackRequeue
+			}
+			return pubsub.Ack
+		default:
+			return pubsub.NackDiscard
+		}
+	}
+}
+
+func (s *Session) handlerWar() func(context.Context, gamelogic.RecognitionOfWar) pubsub.AckType {
+	return func(ctx context.Context, rw gamelogic.RecognitionOfWar) pubsub.AckType {
+		gs := s.GameState
+		outcome, result := gs.HandleWar(rw)
+		warsTotal.WithLabelValues(outcome.String()).Inc()
+		ackType := pubsub.Ack
+		msg := ""
+		switch outcome {
+		case gamelogic.WarOutcomeNotInvolved:
+			ackType = pubsub.NackRequeue
+		case gamelogic.WarOutcomeNoUnits, gamelogic.WarOutcomePact:
+			ackType = pubsub.NackDiscard
+		case gamelogic.WarOutcomeOpponentWon:
+			msg = fmt.Sprintf("%s won a war against %s", result.Winner, result.Loser)
+			ackType = pubsub.Ack
+		case gamelogic.WarOutcomeYouWon:
+			msg = fmt.Sprintf("%s won a war against %s", result.Winner, result.Loser)
+			ackType = pubsub.Ack
+		case gamelogic.WarOutcomeDraw:
+			msg = fmt.Sprintf("A war between %s and %s resulted in a draw", result.Winner, result.Loser)
+			ackType = pubsub.Ack
+		default:
+			slog.Error("unknown war outcome", "outcome", int(outcome))
+			ackType = pubsub.NackDiscard
+		}
+		if msg != "" {
+			err := pubsub.PublishJSONWithContext(
+				ctx,
+				s.pub,
+				routing.ExchangePerilTopic,
+				routing.WarResultsPrefix+"."+gs.GetUsername(),
+				result,
+			)
+			if err != nil {
+				slog.Error("could not publish war result", "attacker", rw.Attacker.Username, "err", err)
+				return pubsub.NackRequeue
+			}
+			err = pubsub.PublishGobWithContext(
+				ctx,
+				s.pub,
+				routing.ExchangePerilTopic,
+				routing.GameLogSlug+"."+rw.Attacker.Username,
+				routing.GameLog{
+					Username:    gs.GetUsername(),
+					Message:     msg,
+					CurrentTime: gs.Now(),
+				},
+			)
+			if err != nil {
+				slog.Error("could not publish game log", "attacker", rw.Attacker.Username, "err", err)
+				return pubsub.NackRequeue
+			}
+		}
+		return ackType
+	}
+}
+
+func (s *Session) handlerWarResult() func(gamelogic.WarResult) pubsub.AckType {
+	return func(wr gamelogic.WarResult) pubsub.AckType {
+		s.GameState.HandleWarResult(wr)
+		return pubsub.Ack
+	}
+}
+
+func (s *Session) handlerSightings() func(gamelogic.SightingReport) pubsub.AckType {
+	return func(report gamelogic.SightingReport) pubsub.AckType {
+		s.GameState.HandleSightings(report)
+		return pubsub.Ack
+	}
+}
+
+func (s *Session) handlerDiplomacy() func(context.Context, gamelogic.Diplomacy) pubsub.AckType {
+	return func(ctx context.Context, d gamelogic.Diplomacy) pubsub.AckType {
+		from, to, ok := routing.DiplomacyParties(pubsub.RoutingKey(ctx))
+		if !ok || d.From != from || d.To != to {
+			slog.Warn("dropping diplomacy sent under another name", "routing_key", pubsub.RoutingKey(ctx), "claimed", d.From)
+			return pubsub.NackDiscard
+		}
+		s.GameState.HandleDiplomacy(d)
+		return pubsub.Ack
+	}
+}
+
+func (s *Session) handlerChat() func(routing.ChatMessage) pubsub.AckType {
+	return func(msg routing.ChatMessage) pubsub.AckType {
+		s.GameState.HandleChat(msg)
+		return pubsub.Ack
+	}
+}
+
+func (s *Session) handlerGameOver() func(routing.GameOver) pubsub.AckType {
+	return func(over routing.GameOver) pubsub.AckType {
+		s.GameState.HandleGameOver(over)
+		return pubsub.Ack
+	}
+}
+
+func (s *Session) handlerKick() func(routing.Kick) pubsub.AckType {
+	return func(kick routing.Kick) pubsub.AckType {
+		s.GameState.HandleKick(kick)
+		return pubsub.Ack
+	}
+}
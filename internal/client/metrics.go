@@ -0,0 +1,21 @@
+package client
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	movesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "peril_client_moves_total",
+		Help: "Moves published by players of this process.",
+	})
+	spawnsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_client_spawns_total",
+		Help: "Units spawned by players of this process, by rank.",
+	}, []string{"rank"})
+	warsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_client_wars_total",
+		Help: "Recognitions of war handled, by outcome for the player handling them.",
+	}, []string{"outcome"})
+)
@@ -0,0 +1,265 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/ratelimit"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Session connects a player's GameState to the broker: it subscribes to
+// every queue the player needs and publishes the results of their commands.
+// It is shared by the interactive client and the bots.
+type Session struct {
+	GameState *gamelogic.GameState
+	pub       pubsub.Publisher
+	src       pubsub.Source
+	ch        *amqp.Channel
+	confirmCh *amqp.Channel
+	outbox    *pubsub.Outbox
+	logLimit  *ratelimit.Limiter
+}
+
+// Messages redelivered to a session are skipped if they have been handled
+// in the last dedupTTL, so that a war is never fought twice.
+const (
+	dedupSize = 10000
+	dedupTTL  = time.Hour
+)
+
+func NewSession(conn *amqp.Connection, gs *gamelogic.GameState) (*Session, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	// Moves and spawns go through an outbox on a channel of their own, in
+	// confirm mode, so that units only move or appear once the broker has
+	// the message.
+	confirmCh, err := conn.Channel()
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	confirming, err := pubsub.NewConfirmingPublisher(confirmCh)
+	if err != nil {
+		confirmCh.Close()
+		ch.Close()
+		return nil, err
+	}
+	src := pubsub.Deduplicate(pubsub.NewConnSource(conn), pubsub.NewDedupStore(dedupSize, dedupTTL))
+	s := newSession(ch, confirming, src, gs)
+	s.ch = ch
+	s.confirmCh = confirmCh
+	return s, nil
+}
+
+// NewSessionWith creates a session that publishes and subscribes through
+// something other than a RabbitMQ connection, such as an in-memory bus.
+// Such publishers are expected to have a message routed by the time they
+// return, so moves and spawns are made as soon as pub succeeds.
+func NewSessionWith(pub pubsub.Publisher, src pubsub.Source, gs *gamelogic.GameState) *Session {
+	return newSession(pub, pub, src, gs)
+}
+
+func newSession(pub, confirming pubsub.Publisher, src pubsub.Source, gs *gamelogic.GameState) *Session {
+	return &Session{
+		GameState: gs,
+		pub:       pub,
+		src:       src,
+		outbox:    pubsub.NewOutbox(confirming),
+	}
+}
+
+// SetGameLogLimit throttles PublishGameLog to rate logs a second, after a
+// burst of burst logs, so that the server doesn't have to refuse them. A
+// rate of zero turns throttling off.
+func (s *Session) SetGameLogLimit(rate float64, burst int) {
+	if rate <= 0 {
+		s.logLimit = nil
+		return
+	}
+	s.logLimit = ratelimit.New(rate, burst)
+}
+
+func (s *Session) Close() error {
+	s.outbox.Close()
+	if s.confirmCh != nil {
+		s.confirmCh.Close()
+	}
+	if s.ch == nil {
+		return nil
+	}
+	return s.ch.Close()
+}
+
+func (s *Session) Subscribe() error {
+	username := s.GameState.GetUsername()
+	err := pubsub.SubscribeJSONFrom(
+		s.src,
+		routing.ExchangePerilDirect,
+		routing.PauseKey+"."+username,
+		routing.PauseKey,
+		pubsub.Transient,
+		s.handlerPause(),
+	)
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSONWithContext(
+		s.src,
+		routing.ExchangePerilTopic,
+		routing.VisibleMovesPrefix+"."+username,
+		routing.VisibleMovesPrefix+"."+username,
+		pubsub.Transient,
+		s.handlerMove(),
+	)
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSONFrom(
+		s.src,
+		routing.ExchangePerilTopic,
+		routing.SightingsPrefix+"."+username,
+		routing.SightingsPrefix+"."+username,
+		pubsub.Transient,
+		s.handlerSightings(),
+	)
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSONWithContext(
+		s.src,
+		routing.ExchangePerilTopic,
+		routing.WarRecognitionsPrefix,
+		routing.WarRecognitionsPrefix+".*",
+		pubsub.Durable,
+		s.handlerWar(),
+	)
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSONFrom(
+		s.src,
+		routing.ExchangePerilTopic,
+		routing.WarResultsPrefix+"."+username,
+		routing.WarResultsPrefix+".*",
+		pubsub.Transient,
+		s.handlerWarResult(),
+	)
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSONWithContext(
+		s.src,
+		routing.ExchangePerilTopic,
+		routing.DiplomacyPrefix+"."+username,
+		routing.DiplomacyKey("*", username),
+		pubsub.Transient,
+		s.handlerDiplomacy(),
+	)
+	if err != nil {
+		return err
+	}
+	chatKeys := []string{
+		routing.ChatPrefix + "." + routing.ChatGlobal,
+		routing.ChatPrefix + "." + routing.ChatGame + "." + s.GameState.GetGame(),
+		routing.ChatPrefix + "." + routing.ChatAlliance + "." + username,
+		routing.ChatPrefix + "." + routing.ChatWhisper + "." + username,
+	}
+	for _, key := range chatKeys {
+		err = pubsub.SubscribeJSONFrom(
+			s.src,
+			routing.ExchangePerilTopic,
+			key+"."+username,
+			key,
+			pubsub.Transient,
+			s.handlerChat(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	err = pubsub.SubscribeJSONFrom(
+		s.src,
+		routing.ExchangePerilDirect,
+		routing.GameOverKey+"."+username,
+		routing.GameOverKey,
+		pubsub.Transient,
+		s.handlerGameOver(),
+	)
+	if err != nil {
+		return err
+	}
+	return pubsub.SubscribeJSONFrom(
+		s.src,
+		routing.ExchangePerilDirect,
+		routing.KickPrefix+"."+username,
+		routing.KickPrefix+"."+username,
+		pubsub.Transient,
+		s.handlerKick(),
+	)
+}
+
+func (s *Session) Move(words []string) error {
+	move, err := s.GameState.PlanMove(words)
+	if err != nil {
+		return err
+	}
+	// The units only move once the broker has the move, so a move nobody
+	// else saw is never shown as made.
+	return pubsub.PostJSON(context.Background(), s.outbox, routing.ExchangePerilTopic, routing.ArmyMovesPrefix+"."+move.Username, move, func() {
+		s.GameState.ApplyMove(move)
+		movesTotal.Inc()
+	})
+}
+
+func (s *Session) Spawn(words []string) error {
+	spawn, err := s.GameState.PlanSpawn(words)
+	if err != nil {
+		return err
+	}
+	// Like a move, the unit only appears once the broker has the spawn.
+	return pubsub.PostJSON(context.Background(), s.outbox, routing.ExchangePerilTopic, routing.ArmySpawnsPrefix+"."+spawn.Username, spawn, func() {
+		s.GameState.ApplySpawn(spawn)
+		spawnsTotal.WithLabelValues(string(spawn.Unit.Rank)).Inc()
+	})
+}
+
+func (s *Session) Diplomacy(words []string) error {
+	d, err := s.GameState.CommandDiplomacy(words)
+	if err != nil {
+		return err
+	}
+	return pubsub.PublishJSON(s.pub, routing.ExchangePerilTopic, routing.DiplomacyKey(d.From, d.To), d)
+}
+
+// Chat handles both the say and whisper commands.
+func (s *Session) Chat(words []string) error {
+	var msg routing.ChatMessage
+	var err error
+	if len(words) > 0 && words[0] == "whisper" {
+		msg, err = s.GameState.CommandWhisper(words)
+	} else {
+		msg, err = s.GameState.CommandSay(words)
+	}
+	if err != nil {
+		return err
+	}
+	return pubsub.PublishJSON(s.pub, routing.ExchangePerilTopic, routing.ChatRequestsPrefix+"."+msg.From, msg)
+}
+
+func (s *Session) PublishGameLog(msg string) error {
+	username := s.GameState.GetUsername()
+	if s.logLimit != nil {
+		s.logLimit.Wait(username)
+	}
+	return pubsub.PublishGob(s.pub, routing.ExchangePerilTopic, routing.GameLogSlug+"."+username, routing.GameLog{
+		Username:    username,
+		Message:     msg,
+		CurrentTime: s.GameState.Now(),
+	})
+}
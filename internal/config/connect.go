@@ -0,0 +1,108 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ConnFactory opens connections to the broker. Certificates, keys and
+// passwords are read once, when the factory is made, so a bad file is
+// reported at startup rather than on the first connection.
+type ConnFactory struct {
+	url    string
+	config amqp.Config
+}
+
+// ConnFactory prepares to connect to the broker the config describes.
+func (c Config) ConnFactory() (*ConnFactory, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, err
+	}
+	f := &ConnFactory{
+		url: c.URL,
+		config: amqp.Config{
+			Vhost: c.VHost,
+		},
+	}
+	if u.Scheme == "amqps" {
+		tlsConfig, err := c.TLS.clientConfig()
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = u.Hostname()
+		}
+		f.config.TLSClientConfig = tlsConfig
+	}
+
+	switch {
+	case c.Auth.Mechanism == "external":
+		f.config.SASL = []amqp.Authentication{&amqp.ExternalAuth{}}
+	case c.Auth.User != "":
+		password, err := c.Auth.readPassword()
+		if err != nil {
+			return nil, err
+		}
+		f.config.SASL = []amqp.Authentication{&amqp.PlainAuth{
+			Username: c.Auth.User,
+			Password: password,
+		}}
+	}
+	return f, nil
+}
+
+// Dial opens a new connection.
+func (f *ConnFactory) Dial() (*amqp.Connection, error) {
+	config := f.config
+	if config.TLSClientConfig != nil {
+		// The TLS config is filled in while dialing, so every connection
+		// gets its own copy.
+		config.TLSClientConfig = config.TLSClientConfig.Clone()
+	}
+	return amqp.DialConfig(f.url, config)
+}
+
+func (t TLS) clientConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: t.ServerName,
+	}
+	if t.CA != "" {
+		pem, err := os.ReadFile(t.CA)
+		if err != nil {
+			return nil, fmt.Errorf("could not read tls ca: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("error: %s has no PEM certificates", t.CA)
+		}
+	}
+	if t.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, fmt.Errorf("could not load tls cert: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// readPassword returns the password from the password file, or from the
+// environment if there is no file. A trailing newline in the file is not
+// part of the password.
+func (a Auth) readPassword() (string, error) {
+	if a.PasswordFile == "" {
+		return a.password, nil
+	}
+	data, err := os.ReadFile(a.PasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("could not read amqp password file: %v", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// setting is one config value that can be set by a flag and an environment
+// variable. The variable is the flag name in upper case with dashes turned
+// into underscores and PERIL_ in front.
+type setting struct {
+	name  string
+	usage string
+	value func(c *Config) flag.Value
+}
+
+func settings() []setting {
+	return []setting{
+		{"url", "AMQP URL of the broker", func(c *Config) flag.Value { return (*stringValue)(&c.URL) }},
+		{"vhost", "virtual host, overriding the one in the URL", func(c *Config) flag.Value { return (*stringValue)(&c.VHost) }},
+		{"tls-ca", "PEM file of the CA that signed the broker's certificate", func(c *Config) flag.Value { return (*stringValue)(&c.TLS.CA) }},
+		{"tls-cert", "PEM certificate to present to the broker", func(c *Config) flag.Value { return (*stringValue)(&c.TLS.Cert) }},
+		{"tls-key", "PEM key for -tls-cert", func(c *Config) flag.Value { return (*stringValue)(&c.TLS.Key) }},
+		{"tls-server-name", "name on the broker's certificate, if not the host in the URL", func(c *Config) flag.Value { return (*stringValue)(&c.TLS.ServerName) }},
+		{"auth", "how to log in to the broker: plain, or external to be identified by -tls-cert", func(c *Config) flag.Value { return (*stringValue)(&c.Auth.Mechanism) }},
+		{"amqp-user", "user to log in to the broker as instead of the one in the URL", func(c *Config) flag.Value { return (*stringValue)(&c.Auth.User) }},
+		{"amqp-password-file", "file holding the password for -amqp-user, or set $PERIL_AMQP_PASSWORD", func(c *Config) flag.Value { return (*stringValue)(&c.Auth.PasswordFile) }},
+		{"exchange-direct", "name of the direct exchange", func(c *Config) flag.Value { return (*stringValue)(&c.Exchanges.Direct) }},
+		{"exchange-topic", "name of the topic exchange", func(c *Config) flag.Value { return (*stringValue)(&c.Exchanges.Topic) }},
+		{"queue-type", "type of the durable queues: classic or quorum", func(c *Config) flag.Value { return (*stringValue)(&c.QueueType) }},
+		{"log-path", "file the server writes game logs to", func(c *Config) flag.Value { return (*stringValue)(&c.LogPath) }},
+		{"prefetch", "unacknowledged messages each consumer may hold, 0 for no limit", func(c *Config) flag.Value { return (*intValue)(&c.Prefetch) }},
+		{"username", "username to play as instead of being asked for one", func(c *Config) flag.Value { return (*stringValue)(&c.Username) }},
+		{"log-level", "least severe diagnostics to log: debug, info, warn or error", func(c *Config) flag.Value { return (*stringValue)(&c.Logging.Level) }},
+		{"log-format", "format of diagnostics: text or json", func(c *Config) flag.Value { return (*stringValue)(&c.Logging.Format) }},
+		{"log-file", "file to append diagnostics to instead of the terminal", func(c *Config) flag.Value { return (*stringValue)(&c.Logging.File) }},
+	}
+}
+
+func envName(name string) string {
+	return "PERIL_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Flags are the config flags registered on a flag set.
+type Flags struct {
+	fs    *flag.FlagSet
+	path  *string
+	print *bool
+	// flagged only holds the values given on the command line; Load
+	// copies the ones that were set over the other sources.
+	flagged Config
+}
+
+// Register adds the config flags to fs, along with -config to name a
+// config file and -print-config. Call Load once fs has been parsed.
+func Register(fs *flag.FlagSet) *Flags {
+	f := &Flags{
+		fs:      fs,
+		flagged: Default(),
+	}
+	f.path = fs.String("config", os.Getenv(envName("config")), "JSON config file, defaults to $PERIL_CONFIG")
+	f.print = fs.Bool("print-config", false, "print the config that would be used and exit")
+	for _, s := range settings() {
+		fs.Var(s.value(&f.flagged), s.name, fmt.Sprintf("%s (env %s)", s.usage, envName(s.name)))
+	}
+	return f
+}
+
+// PrintRequested reports whether -print-config was given.
+func (f *Flags) PrintRequested() bool {
+	return *f.print
+}
+
+// Load builds and validates the config from the defaults, the config file,
+// the environment and the flags that were set.
+func (f *Flags) Load() (Config, error) {
+	c := Default()
+	if *f.path != "" {
+		data, err := os.ReadFile(*f.path)
+		if err != nil {
+			return Config{}, fmt.Errorf("could not read config file: %v", err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&c)
+		if err != nil {
+			return Config{}, fmt.Errorf("could not parse config file %s: %v", *f.path, err)
+		}
+	}
+
+	for _, s := range settings() {
+		env, ok := os.LookupEnv(envName(s.name))
+		if !ok {
+			continue
+		}
+		err := s.value(&c).Set(env)
+		if err != nil {
+			return Config{}, fmt.Errorf("error: %s is not valid for %s: %v", env, envName(s.name), err)
+		}
+	}
+
+	c.Auth.password = os.Getenv("PERIL_AMQP_PASSWORD")
+
+	set := map[string]bool{}
+	f.fs.Visit(func(fl *flag.Flag) {
+		set[fl.Name] = true
+	})
+	for _, s := range settings() {
+		if set[s.name] {
+			s.value(&c).Set(s.value(&f.flagged).String())
+		}
+	}
+
+	return c, c.Validate()
+}
+
+type stringValue string
+
+func (v *stringValue) String() string {
+	return string(*v)
+}
+
+func (v *stringValue) Set(s string) error {
+	*v = stringValue(s)
+	return nil
+}
+
+type intValue int
+
+func (v *intValue) String() string {
+	return strconv.Itoa(int(*v))
+}
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*v = intValue(n)
+	return nil
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// SetupLogging makes slog's default logger write the diagnostics to the
+// log file, or to out if there isn't one. The returned function closes the
+// file.
+func (c Config) SetupLogging(out io.Writer) (func() error, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(c.Logging.Level))
+	if err != nil {
+		return nil, err
+	}
+	closeFile := func() error { return nil }
+	if c.Logging.File != "" {
+		f, err := os.OpenFile(c.Logging.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("could not open log file: %v", err)
+		}
+		out = f
+		closeFile = f.Close
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(out, opts)
+	if c.Logging.Format == "json" {
+		handler = slog.NewJSONHandler(out, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+	return closeFile, nil
+}
@@ -0,0 +1,190 @@
+// Package console reads commands from the terminal with line editing,
+// persistent history and tab completion, and lets messages that arrive
+// while the player is typing be printed without trampling their input.
+package console
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Completer returns the possible values for the word being typed, given the
+// words before it and what has been typed of it so far. Candidates that do
+// not start with partial are ignored.
+type Completer func(words []string, partial string) []string
+
+// Editor reads lines from stdin. When stdin is a terminal the line can be
+// edited, the arrow keys walk through the history and tab completes the
+// current word; otherwise lines are read as they are.
+type Editor struct {
+	prompt   string
+	complete Completer
+	history  *history
+	fd       int
+	term     *term.Terminal
+	scanner  *bufio.Scanner
+}
+
+// New creates an editor. History is loaded from and appended to
+// historyPath unless it is empty, and complete may be nil.
+func New(prompt, historyPath string, complete Completer) (*Editor, error) {
+	e := &Editor{
+		prompt:   prompt,
+		complete: complete,
+		fd:       int(os.Stdin.Fd()),
+	}
+	if !term.IsTerminal(e.fd) {
+		e.scanner = bufio.NewScanner(os.Stdin)
+		return e, nil
+	}
+
+	h, err := loadHistory(historyPath)
+	if err != nil {
+		return nil, err
+	}
+	e.history = h
+	e.term = term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, prompt)
+	e.term.History = h
+	e.term.AutoCompleteCallback = e.autoComplete
+	return e, nil
+}
+
+// ReadLine waits for the next line. It returns io.EOF when the input ends
+// or the player presses Ctrl-C or Ctrl-D.
+func (e *Editor) ReadLine() (string, error) {
+	if e.term == nil {
+		os.Stdout.WriteString(e.prompt)
+		if !e.scanner.Scan() {
+			if err := e.scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", io.EOF
+		}
+		return strings.TrimSpace(e.scanner.Text()), nil
+	}
+
+	// The terminal is only raw while a line is being read, so everything
+	// else can keep printing normally.
+	state, err := term.MakeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(e.fd, state)
+	if width, height, err := term.GetSize(e.fd); err == nil && width > 0 {
+		e.term.SetSize(width, height)
+	}
+	line, err := e.term.ReadLine()
+	return strings.TrimSpace(line), err
+}
+
+// ReadWords reads the next line and splits it into words. It returns nil
+// once there is nothing left to read.
+func (e *Editor) ReadWords() []string {
+	line, err := e.ReadLine()
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(line)
+}
+
+// Write prints p above the prompt and redraws the prompt and whatever the
+// player has typed so far. It is safe to call while ReadLine is waiting.
+func (e *Editor) Write(p []byte) (int, error) {
+	if e.term == nil {
+		return os.Stdout.Write(p)
+	}
+	return e.term.Write(p)
+}
+
+func (e *Editor) SetPrompt(prompt string) {
+	e.prompt = prompt
+	if e.term != nil {
+		e.term.SetPrompt(prompt)
+	}
+}
+
+func (e *Editor) Close() error {
+	if e.history == nil {
+		return nil
+	}
+	return e.history.close()
+}
+
+// autoComplete completes the word before the cursor when tab is pressed,
+// listing the candidates when there is more than one.
+func (e *Editor) autoComplete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || e.complete == nil {
+		return "", 0, false
+	}
+	before, matches := Complete(e.complete, line[:pos])
+	if len(matches) > 1 {
+		e.term.Write([]byte(strings.Join(matches, "  ") + "\n"))
+	}
+	if before == line[:pos] {
+		return "", 0, false
+	}
+	return before + line[pos:], len(before), true
+}
+
+// Complete completes the last word of before, which is everything typed up
+// to the cursor. A single match is completed along with a trailing space
+// and several matches are completed as far as they agree. The matches are
+// returned when that does not get any further, so that they can be shown.
+func Complete(complete Completer, before string) (string, []string) {
+	words := strings.Fields(before)
+	partial := ""
+	if len(words) > 0 && !strings.HasSuffix(before, " ") {
+		partial = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	matches := []string{}
+	for _, candidate := range complete(words, partial) {
+		if strings.HasPrefix(candidate, partial) {
+			matches = append(matches, candidate)
+		}
+	}
+	sort.Strings(matches)
+	matches = unique(matches)
+	if len(matches) == 0 {
+		return before, nil
+	}
+
+	start := len(before) - len(partial)
+	if len(matches) == 1 {
+		return before[:start] + matches[0] + " ", nil
+	}
+	prefix := commonPrefix(matches)
+	if prefix == partial {
+		return before, matches
+	}
+	return before[:start] + prefix, nil
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+func unique(sorted []string) []string {
+	out := []string{}
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
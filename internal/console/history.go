@@ -0,0 +1,147 @@
+package console
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// maxHistory is how many lines are kept in memory and loaded from disk.
+const maxHistory = 1000
+
+// history keeps the lines the player entered, oldest first, and appends
+// every new one to a file so that it survives restarts. The file is cut
+// back to the lines kept in memory when it is closed, or sooner if it
+// reaches twice that many.
+type history struct {
+	lines []string
+	path  string
+	file  *os.File
+	// written is how many lines the file has.
+	written int
+	mu      *sync.Mutex
+}
+
+func loadHistory(path string) (*history, error) {
+	h := &history{path: path, mu: &sync.Mutex{}}
+	if path == "" {
+		return h, nil
+	}
+	f, err := os.Open(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			h.push(strings.TrimSpace(scanner.Text()))
+			h.written++
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	h.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// push adds a line unless it is blank or repeats the previous one, and
+// reports whether it did.
+func (h *history) push(line string) bool {
+	if line == "" {
+		return false
+	}
+	if len(h.lines) > 0 && h.lines[len(h.lines)-1] == line {
+		return false
+	}
+	h.lines = append(h.lines, line)
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[len(h.lines)-maxHistory:]
+	}
+	return true
+}
+
+// Add implements term.History.
+func (h *history) Add(line string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	line = strings.TrimSpace(line)
+	if !h.push(line) || h.file == nil {
+		return
+	}
+	h.file.WriteString(line + "\n")
+	h.written++
+	if h.written >= 2*maxHistory {
+		h.truncate()
+	}
+}
+
+// truncate replaces the file with the lines kept in memory. History is a
+// convenience, so if that fails the file is left as it was.
+func (h *history) truncate() {
+	var buf strings.Builder
+	for _, line := range h.lines {
+		buf.WriteString(line + "\n")
+	}
+	tmp := h.path + ".tmp"
+	err := os.WriteFile(tmp, []byte(buf.String()), 0600)
+	if err != nil {
+		return
+	}
+	err = os.Rename(tmp, h.path)
+	if err != nil {
+		os.Remove(tmp)
+		return
+	}
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	h.file.Close()
+	h.file = f
+	h.written = len(h.lines)
+}
+
+// Len implements term.History.
+func (h *history) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.lines)
+}
+
+// At implements term.History, where 0 is the most recent line.
+func (h *history) At(i int) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lines[len(h.lines)-1-i]
+}
+
+func (h *history) close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file == nil {
+		return nil
+	}
+	if h.written > len(h.lines) {
+		h.truncate()
+	}
+	return h.file.Close()
+}
+
+// DefaultHistoryPath returns name in the user's home directory, or an
+// empty path, meaning no history is kept, if there is no home directory.
+func DefaultHistoryPath(name string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, name)
+}
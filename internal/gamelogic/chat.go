@@ -0,0 +1,63 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+func (gs *GameState) CommandSay(words []string) (routing.ChatMessage, error) {
+	if len(words) < 3 {
+		return routing.ChatMessage{}, errors.New("usage: say <global|game|alliance> <message>")
+	}
+	msg := routing.ChatMessage{
+		From:    gs.GetUsername(),
+		Channel: words[1],
+		Text:    strings.Join(words[2:], " "),
+		SentAt:  gs.Now(),
+	}
+	switch msg.Channel {
+	case routing.ChatGlobal:
+	case routing.ChatGame:
+		msg.Game = gs.GetGame()
+	case routing.ChatAlliance:
+		msg.Recipients = gs.GetAllies()
+		if len(msg.Recipients) == 0 {
+			return routing.ChatMessage{}, errors.New("error: you have no allies")
+		}
+	default:
+		return routing.ChatMessage{}, fmt.Errorf("error: %s is not a valid channel", msg.Channel)
+	}
+	return msg, nil
+}
+
+func (gs *GameState) CommandWhisper(words []string) (routing.ChatMessage, error) {
+	if len(words) < 3 {
+		return routing.ChatMessage{}, errors.New("usage: whisper <player> <message>")
+	}
+	if words[1] == gs.GetUsername() {
+		return routing.ChatMessage{}, errors.New("error: you can not whisper to yourself")
+	}
+	return routing.ChatMessage{
+		From:       gs.GetUsername(),
+		Channel:    routing.ChatWhisper,
+		Recipients: []string{words[1]},
+		Text:       strings.Join(words[2:], " "),
+		SentAt:     gs.Now(),
+	}, nil
+}
+
+func (gs *GameState) HandleChat(msg routing.ChatMessage) {
+	gs.present(ChatReceived{Message: msg})
+}
+
+// ChatLabel is what a chat message is shown under: its channel, or for game
+// chat the game it was sent in.
+func ChatLabel(msg routing.ChatMessage) string {
+	if msg.Channel == routing.ChatGame && msg.Game != "" {
+		return msg.Game
+	}
+	return msg.Channel
+}
@@ -0,0 +1,219 @@
+package gamelogic
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+type Side int
+
+const (
+	SideNone Side = iota
+	SideAttacker
+	SideDefender
+)
+
+// Battle is the outcome of a single war as decided by a CombatResolver.
+// A Winner of SideNone means the war ended in a draw.
+type Battle struct {
+	Winner             Side
+	AttackerPower      int
+	DefenderPower      int
+	AttackerCasualties []int
+	DefenderCasualties []int
+}
+
+// CombatResolver decides the outcome of a war between the units two players
+// have in the same location. Resolvers must be deterministic for a given
+// seed so that a war can be replayed from its WarResult.
+type CombatResolver interface {
+	Name() string
+	Resolve(attacker, defender []Unit, location Location, seed int64) Battle
+}
+
+func NewCombatResolver(name string) (CombatResolver, error) {
+	switch name {
+	case "", PowerSumResolver{}.Name():
+		return PowerSumResolver{}, nil
+	case DiceResolver{}.Name():
+		return NewDiceResolver(), nil
+	}
+	return nil, fmt.Errorf("error: %s is not a valid combat resolver", name)
+}
+
+// PowerSumResolver is the classic Peril combat: the side with the higher
+// power level wins and the loser loses every unit. A draw kills everyone.
+type PowerSumResolver struct{}
+
+func (PowerSumResolver) Name() string {
+	return "sum"
+}
+
+func (PowerSumResolver) Resolve(attacker, defender []Unit, location Location, seed int64) Battle {
+	battle := Battle{
+		AttackerPower: UnitsToPowerLevel(attacker),
+		DefenderPower: UnitsToPowerLevel(defender),
+	}
+	if battle.AttackerPower > battle.DefenderPower {
+		battle.Winner = SideAttacker
+		battle.DefenderCasualties = unitIDs(defender)
+	} else if battle.DefenderPower > battle.AttackerPower {
+		battle.Winner = SideDefender
+		battle.AttackerCasualties = unitIDs(attacker)
+	} else {
+		battle.AttackerCasualties = unitIDs(attacker)
+		battle.DefenderCasualties = unitIDs(defender)
+	}
+	return battle
+}
+
+// DiceResolver adds a die roll to every unit's power, rewards units that face
+// a rank they beat (artillery beats infantry, infantry beats cavalry, cavalry
+// beats artillery) and lets defenders dig in on difficult terrain. Casualties
+// are proportional to how lopsided the war was.
+type DiceResolver struct {
+	// DieSides is the size of the die every unit rolls.
+	DieSides int
+	// RankBonus is the percentage added to a unit's power when the enemy
+	// has at least one unit of a rank it beats.
+	RankBonus int
+	// TerrainBonus is the percentage added to the defender's total power
+	// in each location.
+	TerrainBonus map[Location]int
+}
+
+func NewDiceResolver() DiceResolver {
+	return DiceResolver{
+		DieSides:  6,
+		RankBonus: 50,
+		TerrainBonus: map[Location]int{
+			"antarctica": 50,
+			"asia":       20,
+			"europe":     10,
+		},
+	}
+}
+
+func (DiceResolver) Name() string {
+	return "dice"
+}
+
+func (r DiceResolver) Resolve(attacker, defender []Unit, location Location, seed int64) Battle {
+	rng := rand.New(rand.NewSource(seed))
+	attacker = sortedUnits(attacker)
+	defender = sortedUnits(defender)
+
+	battle := Battle{
+		AttackerPower: r.sidePower(attacker, defender, rng),
+		DefenderPower: r.sidePower(defender, attacker, rng),
+	}
+	battle.DefenderPower = battle.DefenderPower * (100 + r.TerrainBonus[location]) / 100
+
+	total := battle.AttackerPower + battle.DefenderPower
+	if battle.AttackerPower > battle.DefenderPower {
+		battle.Winner = SideAttacker
+		battle.DefenderCasualties = pickCasualties(defender, ceilDiv(len(defender)*battle.AttackerPower, total), rng)
+		battle.AttackerCasualties = pickCasualties(attacker, len(attacker)*battle.DefenderPower/total/2, rng)
+	} else if battle.DefenderPower > battle.AttackerPower {
+		battle.Winner = SideDefender
+		battle.AttackerCasualties = pickCasualties(attacker, ceilDiv(len(attacker)*battle.DefenderPower, total), rng)
+		battle.DefenderCasualties = pickCasualties(defender, len(defender)*battle.AttackerPower/total/2, rng)
+	} else {
+		battle.AttackerCasualties = pickCasualties(attacker, ceilDiv(len(attacker), 2), rng)
+		battle.DefenderCasualties = pickCasualties(defender, ceilDiv(len(defender), 2), rng)
+	}
+	return battle
+}
+
+func (r DiceResolver) sidePower(units, enemies []Unit, rng *rand.Rand) int {
+	enemyRanks := map[UnitRank]struct{}{}
+	for _, unit := range enemies {
+		enemyRanks[unit.Rank] = struct{}{}
+	}
+	power := 0
+	for _, unit := range units {
+		p := rankPower(unit.Rank)
+		if _, ok := enemyRanks[rankBeats(unit.Rank)]; ok {
+			p = p * (100 + r.RankBonus) / 100
+		}
+		if r.DieSides > 0 {
+			p += rng.Intn(r.DieSides) + 1
+		}
+		power += p
+	}
+	return power
+}
+
+// rankBeats returns the rank that the given rank has an advantage over.
+func rankBeats(rank UnitRank) UnitRank {
+	switch rank {
+	case RankArtillery:
+		return RankInfantry
+	case RankInfantry:
+		return RankCavalry
+	case RankCavalry:
+		return RankArtillery
+	}
+	return ""
+}
+
+func rankPower(rank UnitRank) int {
+	switch rank {
+	case RankArtillery:
+		return 10
+	case RankCavalry:
+		return 5
+	case RankInfantry:
+		return 1
+	}
+	return 0
+}
+
+func UnitsToPowerLevel(units []Unit) int {
+	power := 0
+	for _, unit := range units {
+		power += rankPower(unit.Rank)
+	}
+	return power
+}
+
+// pickCasualties chooses n of the given units to die, at random but
+// reproducibly for the same rng state.
+func pickCasualties(units []Unit, n int, rng *rand.Rand) []int {
+	if n <= 0 {
+		return nil
+	}
+	if n > len(units) {
+		n = len(units)
+	}
+	ids := []int{}
+	for _, i := range rng.Perm(len(units))[:n] {
+		ids = append(ids, units[i].ID)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func sortedUnits(units []Unit) []Unit {
+	sorted := append([]Unit{}, units...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
+}
+
+func unitIDs(units []Unit) []int {
+	ids := []int{}
+	for _, unit := range sortedUnits(units) {
+		ids = append(ids, unit.ID)
+	}
+	return ids
+}
+
+func ceilDiv(a, b int) int {
+	if b == 0 {
+		return 0
+	}
+	return (a + b - 1) / b
+}
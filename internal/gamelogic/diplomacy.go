@@ -0,0 +1,188 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+type relation struct {
+	Pact       PactType
+	Active     bool
+	ProposedBy string
+}
+
+// CommandDiplomacy handles the propose, accept and break commands and
+// returns the message that should be sent to the other player.
+func (gs *GameState) CommandDiplomacy(words []string) (Diplomacy, error) {
+	if len(words) < 2 {
+		return Diplomacy{}, errors.New("usage: propose <player> <alliance|nonaggression>, accept <player> or break <player>")
+	}
+	action := DiplomacyAction(words[0])
+	other := words[1]
+	if other == gs.GetUsername() {
+		return Diplomacy{}, errors.New("error: you can not make a pact with yourself")
+	}
+
+	d := Diplomacy{
+		From:   gs.GetUsername(),
+		To:     other,
+		Action: action,
+	}
+	err := gs.applyDiplomacy(&d, words)
+	if err != nil {
+		return Diplomacy{}, err
+	}
+	gs.present(DiplomacySent{Diplomacy: d})
+	return d, nil
+}
+
+// applyDiplomacy updates the relation with d.To for an outgoing diplomatic
+// message and fills in its pact.
+func (gs *GameState) applyDiplomacy(d *Diplomacy, words []string) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	other := d.To
+	rel, ok := gs.relations[other]
+	switch d.Action {
+	case DiplomacyPropose:
+		if len(words) < 3 {
+			return errors.New("usage: propose <player> <alliance|nonaggression>")
+		}
+		pact := PactType(words[2])
+		if _, ok := getAllPacts()[pact]; !ok {
+			return fmt.Errorf("error: %s is not a valid pact", pact)
+		}
+		if ok && rel.Active {
+			return fmt.Errorf("error: you already have a %s with %s", rel.Pact, other)
+		}
+		gs.relations[other] = relation{Pact: pact, ProposedBy: gs.Player.Username}
+		d.Pact = pact
+	case DiplomacyAccept:
+		if !ok || rel.Active || rel.ProposedBy != other {
+			return fmt.Errorf("error: %s has not proposed a pact to you", other)
+		}
+		rel.Active = true
+		gs.relations[other] = rel
+		d.Pact = rel.Pact
+	case DiplomacyBreak:
+		if !ok {
+			return fmt.Errorf("error: you have no pact with %s", other)
+		}
+		delete(gs.relations, other)
+		d.Pact = rel.Pact
+	default:
+		return fmt.Errorf("error: %s is not a valid diplomatic action", d.Action)
+	}
+	return nil
+}
+
+func (gs *GameState) HandleDiplomacy(d Diplomacy) {
+	if d.To != gs.GetUsername() {
+		return
+	}
+	event := DiplomacyReceived{Diplomacy: d}
+
+	gs.mu.Lock()
+	rel, ok := gs.relations[d.From]
+	switch d.Action {
+	case DiplomacyPropose:
+		if ok && rel.Active {
+			event.Ignored = true
+			event.Existing = rel.Pact
+			break
+		}
+		gs.relations[d.From] = relation{Pact: d.Pact, ProposedBy: d.From}
+	case DiplomacyAccept:
+		if !ok || rel.ProposedBy != gs.Player.Username {
+			event.Ignored = true
+			break
+		}
+		rel.Active = true
+		gs.relations[d.From] = rel
+		event.Diplomacy.Pact = rel.Pact
+	case DiplomacyBreak:
+		delete(gs.relations, d.From)
+	}
+	gs.mu.Unlock()
+	gs.present(event)
+}
+
+// GetPact returns the pact in force with another player, if any.
+func (gs *GameState) GetPact(username string) (PactType, bool) {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	rel, ok := gs.relations[username]
+	if !ok || !rel.Active {
+		return "", false
+	}
+	return rel.Pact, true
+}
+
+// endPact forgets the pact with another player once they have gone to war.
+func (gs *GameState) endPact(username string) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	rel, ok := gs.relations[username]
+	if ok && rel.Active {
+		delete(gs.relations, username)
+	}
+}
+
+// keptOutBy returns a player with a nonaggression pact with this player
+// who is last known to have units in loc. Allies can share a location, but
+// nonaggression partners keep out of each other's.
+func (gs *GameState) keptOutBy(loc Location) (string, bool) {
+	for _, s := range gs.GetSightingsSnap() {
+		if s.Unit.Location != loc {
+			continue
+		}
+		if pact, ok := gs.GetPact(s.Username); ok && pact == PactNonAggression {
+			return s.Username, true
+		}
+	}
+	return "", false
+}
+
+// GetAllies returns every player this player has an active alliance with.
+func (gs *GameState) GetAllies() []string {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	allies := []string{}
+	for username, rel := range gs.relations {
+		if rel.Active && rel.Pact == PactAlliance {
+			allies = append(allies, username)
+		}
+	}
+	sort.Strings(allies)
+	return allies
+}
+
+func (gs *GameState) getRelationsSnap() map[string]relation {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	relations := map[string]relation{}
+	for k, v := range gs.relations {
+		relations[k] = v
+	}
+	return relations
+}
+
+// ListPacts returns every kind of pact in alphabetical order.
+func ListPacts() []PactType {
+	pacts := []PactType{}
+	for pact := range getAllPacts() {
+		pacts = append(pacts, pact)
+	}
+	sort.Slice(pacts, func(i, j int) bool {
+		return pacts[i] < pacts[j]
+	})
+	return pacts
+}
+
+func getAllPacts() map[PactType]struct{} {
+	return map[PactType]struct{}{
+		PactAlliance:      {},
+		PactNonAggression: {},
+	}
+}
@@ -0,0 +1,159 @@
+package gamelogic
+
+import (
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// Event is something that happened to a player. The game logic hands every
+// event to the player's Presenter instead of writing to the terminal.
+type Event interface {
+	Kind() string
+}
+
+// Paused is sent when the server pauses or resumes the game.
+type Paused struct {
+	Paused bool
+}
+
+// MoveDetected is sent when another player's move comes into view. Location
+// is where the two players' units meet, if anywhere, and Pact is the pact
+// with the mover: an alliance keeps them from going to war there, and a
+// nonaggression pact is broken by it.
+type MoveDetected struct {
+	Move     ArmyMove
+	Outcome  MoveOutcome
+	Location Location
+	Pact     PactType
+}
+
+// Moved is sent when the player moves their own units.
+type Moved struct {
+	Move ArmyMove
+}
+
+// Spawned is sent when the player spawns a unit.
+type Spawned struct {
+	Unit Unit
+}
+
+// WarFought is sent for every recognition of war the player handles, even
+// the ones they are not involved in. Casualties are the player's own units
+// that died, and Pact is the pact that called the war off.
+type WarFought struct {
+	Player        string
+	Attacker      string
+	Defender      string
+	Outcome       WarOutcome
+	Pact          PactType
+	AttackerUnits []Unit
+	DefenderUnits []Unit
+	Result        WarResult
+	Casualties    []int
+}
+
+// WarResultReceived is sent to the defender of a war once the attacker has
+// resolved it.
+type WarResultReceived struct {
+	Result WarResult
+}
+
+// DiplomacySent is sent when the player proposes, accepts or breaks a pact.
+type DiplomacySent struct {
+	Diplomacy Diplomacy
+}
+
+// DiplomacyReceived is sent when another player proposes, accepts or breaks
+// a pact. Ignored is set when the message made no sense given the current
+// relations, and Existing is the pact already in force if that was why.
+type DiplomacyReceived struct {
+	Diplomacy Diplomacy
+	Ignored   bool
+	Existing  PactType
+}
+
+// ChatReceived is sent for every chat message delivered to the player.
+type ChatReceived struct {
+	Message routing.ChatMessage
+}
+
+// GameEnded is sent when the referee declares the game over.
+type GameEnded struct {
+	Over routing.GameOver
+	Won  bool
+}
+
+// Kicked is sent when the server removes the player from the game.
+type Kicked struct {
+	Kick routing.Kick
+}
+
+// Relation is a pact, or a proposal for one, with another player.
+type Relation struct {
+	Username   string
+	Pact       PactType
+	Active     bool
+	ProposedBy string
+}
+
+// Status is what the player knows about the game right now.
+type Status struct {
+	Over      bool
+	Paused    bool
+	Player    Player
+	Sightings []Sighting
+	Relations []Relation
+	Now       time.Time
+}
+
+func (Paused) Kind() string            { return "paused" }
+func (MoveDetected) Kind() string      { return "move_detected" }
+func (Moved) Kind() string             { return "moved" }
+func (Spawned) Kind() string           { return "spawned" }
+func (WarFought) Kind() string         { return "war_fought" }
+func (WarResultReceived) Kind() string { return "war_result" }
+func (DiplomacySent) Kind() string     { return "diplomacy_sent" }
+func (DiplomacyReceived) Kind() string { return "diplomacy_received" }
+func (ChatReceived) Kind() string      { return "chat" }
+func (GameEnded) Kind() string         { return "game_over" }
+func (Kicked) Kind() string            { return "kicked" }
+func (Status) Kind() string            { return "status" }
+
+func (o MoveOutcome) String() string {
+	switch o {
+	case MoveOutcomeSamePlayer:
+		return "same_player"
+	case MoveOutComeSafe:
+		return "safe"
+	case MoveOutcomeMakeWar:
+		return "make_war"
+	}
+	return "unknown"
+}
+
+func (o MoveOutcome) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+func (o WarOutcome) String() string {
+	switch o {
+	case WarOutcomeNotInvolved:
+		return "not_involved"
+	case WarOutcomeNoUnits:
+		return "no_units"
+	case WarOutcomeYouWon:
+		return "you_won"
+	case WarOutcomeOpponentWon:
+		return "opponent_won"
+	case WarOutcomeDraw:
+		return "draw"
+	case WarOutcomePact:
+		return "pact"
+	}
+	return "unknown"
+}
+
+func (o WarOutcome) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
@@ -1,5 +1,10 @@
 package gamelogic
 
+import (
+	"sort"
+	"time"
+)
+
 type Player struct {
 	Username string
 	Units    map[int]Unit
@@ -19,17 +24,76 @@ type Unit struct {
 	Location Location
 }
 
+// ArmyMove carries only the units that moved, not the rest of the
+// mover's army. The mover's units that were already at ToLocation are in
+// Stationed, since they fight alongside the moved units in any war the
+// move starts.
 type ArmyMove struct {
-	Player     Player
+	Username   string
 	Units      []Unit
+	Stationed  []Unit
 	ToLocation Location
 }
 
+type ArmySpawn struct {
+	Username string
+	Unit     Unit
+}
+
+// Sighting is the last known position of an enemy unit.
+type Sighting struct {
+	Username string
+	Unit     Unit
+	SeenAt   time.Time
+}
+
+// SightingReport is what the server tells a player their units can see.
+type SightingReport struct {
+	Sightings []Sighting
+}
+
 type RecognitionOfWar struct {
 	Attacker Player
 	Defender Player
 }
 
+type WarResult struct {
+	Attacker           string
+	Defender           string
+	Winner             string
+	Loser              string
+	Draw               bool
+	Location           Location
+	Resolver           string
+	Seed               int64
+	AttackerPower      int
+	DefenderPower      int
+	AttackerCasualties []int
+	DefenderCasualties []int
+}
+
+type PactType string
+
+const (
+	PactAlliance      = "alliance"
+	PactNonAggression = "nonaggression"
+)
+
+type DiplomacyAction string
+
+const (
+	DiplomacyPropose = "propose"
+	DiplomacyAccept  = "accept"
+	DiplomacyBreak   = "break"
+)
+
+type Diplomacy struct {
+	From   string
+	To     string
+	Action DiplomacyAction
+	Pact   PactType
+}
+
 type Location string
 
 func getAllRanks() map[UnitRank]struct{} {
@@ -50,3 +114,32 @@ func getAllLocations() map[Location]struct{} {
 		"antarctica": {},
 	}
 }
+
+// ListLocations returns every location on the map in alphabetical order.
+func ListLocations() []Location {
+	locations := []Location{}
+	for loc := range getAllLocations() {
+		locations = append(locations, loc)
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		return locations[i] < locations[j]
+	})
+	return locations
+}
+
+// ListRanks returns every unit rank in alphabetical order.
+func ListRanks() []UnitRank {
+	ranks := []UnitRank{}
+	for rank := range getAllRanks() {
+		ranks = append(ranks, rank)
+	}
+	sort.Slice(ranks, func(i, j int) bool {
+		return ranks[i] < ranks[j]
+	})
+	return ranks
+}
+
+// ListAdjacentLocations returns the locations bordering loc.
+func ListAdjacentLocations(loc Location) []Location {
+	return append([]Location{}, getAdjacentLocations()[loc]...)
+}
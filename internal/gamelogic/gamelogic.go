@@ -4,35 +4,59 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
+	"sort"
 	"strings"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
 func PrintClientHelp() {
-	fmt.Println("Possible commands:")
-	fmt.Println("* move <location> <unitID> <unitID> <unitID>...")
-	fmt.Println("    example:")
-	fmt.Println("    move asia 1")
-	fmt.Println("* spawn <location> <rank>")
-	fmt.Println("    example:")
-	fmt.Println("    spawn europe infantry")
-	fmt.Println("* status")
-	fmt.Println("* spam <n>")
-	fmt.Println("    example:")
-	fmt.Println("    spam 5")
-	fmt.Println("* quit")
-	fmt.Println("* help")
+	WriteClientHelp(os.Stdout)
+}
+
+func WriteClientHelp(w io.Writer) {
+	fmt.Fprintln(w, "Possible commands:")
+	fmt.Fprintln(w, "* move <location> <unitID> <unitID> <unitID>...")
+	fmt.Fprintln(w, "    example:")
+	fmt.Fprintln(w, "    move asia 1")
+	fmt.Fprintln(w, "* spawn <location> <rank>")
+	fmt.Fprintln(w, "    example:")
+	fmt.Fprintln(w, "    spawn europe infantry")
+	fmt.Fprintln(w, "* propose <player> <alliance|nonaggression>")
+	fmt.Fprintln(w, "    example:")
+	fmt.Fprintln(w, "    propose washington alliance")
+	fmt.Fprintln(w, "    allies can share locations, nonaggression partners keep out of each other's")
+	fmt.Fprintln(w, "* accept <player>")
+	fmt.Fprintln(w, "* break <player>")
+	fmt.Fprintln(w, "* say <global|game|alliance> <message>")
+	fmt.Fprintln(w, "    example:")
+	fmt.Fprintln(w, "    say global hello everyone")
+	fmt.Fprintln(w, "* whisper <player> <message>")
+	fmt.Fprintln(w, "* status")
+	fmt.Fprintln(w, "* spam <n>")
+	fmt.Fprintln(w, "    example:")
+	fmt.Fprintln(w, "    spam 5")
+	fmt.Fprintln(w, "* quit")
+	fmt.Fprintln(w, "* help")
 }
 
-func ClientWelcome() (string, error) {
+// ClientWelcome asks for a username, reading it with input, which is
+// usually GetInput or a console editor's ReadWords.
+func ClientWelcome(input func() []string) (string, error) {
 	fmt.Println("Welcome to the Peril client!")
 	fmt.Println("Please enter your username:")
-	words := GetInput()
+	words := input()
 	if len(words) == 0 {
 		return "", errors.New("you must enter a username. goodbye")
 	}
 	username := words[0]
+	err := routing.ValidateUsername(username)
+	if err != nil {
+		return "", err
+	}
 	fmt.Printf("Welcome, %s!\n", username)
 	PrintClientHelp()
 	return username, nil
@@ -42,13 +66,19 @@ func PrintServerHelp() {
 	fmt.Println("Possible commands:")
 	fmt.Println("* pause")
 	fmt.Println("* resume")
+	fmt.Println("* standings")
+	fmt.Println("* logs [player=<username>] [since=<time>] [until=<time>] [page=<n>] [text]")
 	fmt.Println("* quit")
 	fmt.Println("* help")
 }
 
+// stdin is shared by every call to GetInput so that lines buffered by one
+// call are not lost to the next.
+var stdin = bufio.NewScanner(os.Stdin)
+
 func GetInput() []string {
 	fmt.Print("> ")
-	scanner := bufio.NewScanner(os.Stdin)
+	scanner := stdin
 	scanned := scanner.Scan()
 	if !scanned {
 		return nil
@@ -77,16 +107,29 @@ func PrintQuit() {
 }
 
 func (gs *GameState) CommandStatus() {
-	if gs.isPaused() {
-		fmt.Println("The game is paused.")
-		return
-	} else {
-		fmt.Println("The game is not paused.")
-	}
+	gs.present(gs.Status())
+}
 
-	p := gs.GetPlayerSnap()
-	fmt.Printf("You are %s, and you have %d units.\n", p.Username, len(p.Units))
-	for _, unit := range p.Units {
-		fmt.Printf("* %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
+// Status reports what the player knows about the game right now.
+func (gs *GameState) Status() Status {
+	status := Status{
+		Over:      gs.IsOver(),
+		Paused:    gs.IsPaused(),
+		Player:    gs.GetPlayerSnap(),
+		Sightings: gs.GetSightingsSnap(),
+		Relations: []Relation{},
+		Now:       gs.Now(),
+	}
+	for username, rel := range gs.getRelationsSnap() {
+		status.Relations = append(status.Relations, Relation{
+			Username:   username,
+			Pact:       rel.Pact,
+			Active:     rel.Active,
+			ProposedBy: rel.ProposedBy,
+		})
 	}
+	sort.Slice(status.Relations, func(i, j int) bool {
+		return status.Relations[i].Username < status.Relations[j].Username
+	})
+	return status
 }
@@ -0,0 +1,41 @@
+package gamelogic
+
+import (
+	"fmt"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+func (gs *GameState) HandleGameOver(over routing.GameOver) {
+	gs.endGame()
+	gs.present(GameEnded{
+		Over: over,
+		Won:  over.Winner != "" && over.Winner == gs.GetUsername(),
+	})
+}
+
+// HandleKick ends the game for a player the server has removed, so that
+// they can no longer move or spawn.
+func (gs *GameState) HandleKick(kick routing.Kick) {
+	gs.endGame()
+	gs.present(Kicked{Kick: kick})
+}
+
+func PrintStandings(standings []routing.Standing) {
+	fmt.Println("Final standings:")
+	for _, line := range FormatStandings(standings) {
+		fmt.Println(line)
+	}
+}
+
+func FormatStandings(standings []routing.Standing) []string {
+	lines := []string{}
+	for i, s := range standings {
+		line := fmt.Sprintf("%d. %s: %d points (%d locations, %d units, power %d)", i+1, s.Username, s.Score, s.Locations, s.Units, s.Power)
+		if s.Eliminated {
+			line += " [eliminated]"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -1,13 +1,33 @@
 package gamelogic
 
 import (
+	"math/rand"
+	"os"
 	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
 type GameState struct {
 	Player Player
 	Paused bool
-	mu     *sync.RWMutex
+	Over   bool
+	game   string
+	// relations holds pacts and pending proposals keyed by the other
+	// player's username.
+	relations map[string]relation
+	// sightings holds the last known position of enemy units keyed by
+	// username and unit ID.
+	sightings map[string]map[int]Sighting
+	// lastUnitID is the ID of the last unit spawned. IDs are never reused,
+	// since units die out of order in wars.
+	lastUnitID int
+	combat     CombatResolver
+	rng        *rand.Rand
+	now        func() time.Time
+	presenter  Presenter
+	mu         *sync.RWMutex
 }
 
 func NewGameState(username string) *GameState {
@@ -16,11 +36,73 @@ func NewGameState(username string) *GameState {
 			Username: username,
 			Units:    map[int]Unit{},
 		},
-		Paused: false,
-		mu:     &sync.RWMutex{},
+		Paused:    false,
+		game:      routing.DefaultGame,
+		relations: map[string]relation{},
+		sightings: map[string]map[int]Sighting{},
+		combat:    PowerSumResolver{},
+		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		now:       time.Now,
+		presenter: NewTextPresenter(os.Stdout),
+		mu:        &sync.RWMutex{},
 	}
 }
 
+func (gs *GameState) SetCombatResolver(r CombatResolver) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.combat = r
+}
+
+// SetSeed makes the seeds handed to the combat resolver, and therefore the
+// outcome of every war this player resolves, reproducible.
+func (gs *GameState) SetSeed(seed int64) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.rng = rand.New(rand.NewSource(seed))
+}
+
+// SetClock replaces the wall clock used to timestamp sightings and
+// messages, so that simulations can control time.
+func (gs *GameState) SetClock(now func() time.Time) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.now = now
+}
+
+// SetPresenter decides how events are shown to the player. The default
+// writes text to stdout.
+func (gs *GameState) SetPresenter(p Presenter) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.presenter = p
+}
+
+func (gs *GameState) present(e Event) {
+	gs.mu.RLock()
+	p := gs.presenter
+	gs.mu.RUnlock()
+	p.Present(e)
+}
+
+func (gs *GameState) Now() time.Time {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.now()
+}
+
+func (gs *GameState) getCombatResolver() CombatResolver {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.combat
+}
+
+func (gs *GameState) nextSeed() int64 {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	return gs.rng.Int63()
+}
+
 func (gs *GameState) resumeGame() {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
@@ -33,25 +115,38 @@ func (gs *GameState) pauseGame() {
 	gs.Paused = true
 }
 
-func (gs *GameState) isPaused() bool {
+func (gs *GameState) IsPaused() bool {
 	gs.mu.RLock()
 	defer gs.mu.RUnlock()
 	return gs.Paused
 }
 
-func (gs *GameState) addUnit(u Unit) {
+func (gs *GameState) endGame() {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
-	gs.Player.Units[u.ID] = u
+	gs.Over = true
+}
+
+func (gs *GameState) IsOver() bool {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.Over
 }
 
-func (gs *GameState) removeUnitsInLocation(loc Location) {
+// nextUnitID hands out the next unit ID. An ID handed out for a spawn that
+// never happens is not handed out again.
+func (gs *GameState) nextUnitID() int {
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
-	for k, v := range gs.Player.Units {
-		if v.Location == loc {
-			delete(gs.Player.Units, k)
-		}
+	gs.lastUnitID++
+	return gs.lastUnitID
+}
+
+func (gs *GameState) removeUnits(ids []int) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	for _, id := range ids {
+		delete(gs.Player.Units, id)
 	}
 }
 
@@ -61,6 +156,20 @@ func (gs *GameState) UpdateUnit(u Unit) {
 	gs.Player.Units[u.ID] = u
 }
 
+// SetGame chooses the game this player belongs to, which scopes the game
+// chat channel.
+func (gs *GameState) SetGame(game string) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.game = game
+}
+
+func (gs *GameState) GetGame() string {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	return gs.game
+}
+
 func (gs *GameState) GetUsername() string {
 	return gs.Player.Username
 }
@@ -0,0 +1,443 @@
+package gamelogic
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// Rotation decides when a GameLogSink moves on to a fresh log file. The
+// old file is gzipped next to the log as <log>.<time>.gz, with its block
+// index, and recorded in the index, and archives beyond Keep are deleted,
+// oldest first.
+type Rotation struct {
+	// MaxBytes rotates before a batch would take the log past this size.
+	// Zero means no limit.
+	MaxBytes int64
+	// Daily rotates on the first batch written on a new day.
+	Daily bool
+	// Keep is how many archives to keep. Zero keeps them all.
+	Keep int
+}
+
+// LogSegment is one archived part of the game log. Everything after the
+// last archive is in the log itself.
+type LogSegment struct {
+	// File is the name of the archive, in the same directory as the log.
+	File    string    `json:"file"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+	Entries int       `json:"entries"`
+	// Players are the usernames with entries in the archive, so that
+	// searches for one player can skip the archives they are not in.
+	Players []string `json:"players"`
+}
+
+// IndexPath is where the index of the archives of the log at logPath is
+// kept.
+func IndexPath(logPath string) string {
+	return logPath + ".index.json"
+}
+
+// ReadLogIndex returns the archives of the log at logPath, oldest first.
+func ReadLogIndex(logPath string) ([]LogSegment, error) {
+	data, err := os.ReadFile(IndexPath(logPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []LogSegment{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read log index: %v", err)
+	}
+	segments := []LogSegment{}
+	err = json.Unmarshal(data, &segments)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse log index: %v", err)
+	}
+	return segments, nil
+}
+
+// writeLogIndex replaces the index in one step, so that readers never see
+// half of it.
+func writeLogIndex(logPath string, segments []LogSegment) error {
+	data, err := json.MarshalIndent(segments, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := IndexPath(logPath) + ".tmp"
+	err = os.WriteFile(tmp, append(data, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("could not write log index: %v", err)
+	}
+	return os.Rename(tmp, IndexPath(logPath))
+}
+
+// segment is the log file being written to, and its block index.
+type segment struct {
+	file    *os.File
+	index   *os.File
+	size    int64
+	opened  time.Time
+	first   time.Time
+	last    time.Time
+	entries int
+	players map[string]bool
+	// blocks are the full blocks, which are in the index. block is the
+	// one being filled.
+	blocks       []LogBlock
+	block        LogBlock
+	blockPlayers map[string]bool
+}
+
+// openSegment opens the log at path for appending. The records already in
+// it that are not in its block index are read back and indexed, and the
+// whole index is rebuilt if it does not fit the log.
+func openSegment(path string, now time.Time) (*segment, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open logs file: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not open logs file: %v", err)
+	}
+	size, err := endLine(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	blocks, err := readBlockIndex(path)
+	if err != nil || !blocksFit(blocks, size) {
+		blocks = nil
+	}
+	// The index is written out again, so that a line left half written
+	// by a crash is not appended to.
+	err = writeBlockIndex(path, blocks)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	index, err := os.OpenFile(blockIndexPath(path), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not open block index: %v", err)
+	}
+	seg := &segment{file: f, index: index, size: size, opened: now, players: map[string]bool{}}
+	for _, block := range blocks {
+		seg.addBlock(block)
+	}
+
+	start := seg.indexed()
+	var recordErr error
+	err = readRecords(io.NewSectionReader(f, start, seg.size-start), func(gamelog routing.GameLog, end int64) {
+		if recordErr == nil {
+			recordErr = seg.record(gamelog.CurrentTime, gamelog.Username, start+end)
+		}
+	})
+	if err == nil {
+		err = recordErr
+	}
+	if err != nil {
+		seg.close()
+		return nil, err
+	}
+	if seg.entries > 0 {
+		seg.opened = seg.first
+	}
+	return seg, nil
+}
+
+// endLine ends the last line of the log f, of size bytes, if a crash or a
+// failed write left it half written, so that the next record starts on a
+// line of its own. It returns the new size.
+func endLine(f *os.File, size int64) (int64, error) {
+	if size == 0 {
+		return 0, nil
+	}
+	last := make([]byte, 1)
+	_, err := f.ReadAt(last, size-1)
+	if err != nil {
+		return 0, fmt.Errorf("could not read logs file: %v", err)
+	}
+	if last[0] == '\n' {
+		return size, nil
+	}
+	_, err = f.Write([]byte("\n"))
+	if err != nil {
+		return 0, fmt.Errorf("could not write to logs file: %v", err)
+	}
+	return size + 1, nil
+}
+
+// indexed is where the blocks in the index end, and the block being filled
+// starts.
+func (seg *segment) indexed() int64 {
+	if len(seg.blocks) == 0 {
+		return 0
+	}
+	return seg.blocks[len(seg.blocks)-1].end()
+}
+
+// record adds the record that ends at end to the block being filled, and
+// writes the block to the index once it is full.
+func (seg *segment) record(at time.Time, username string, end int64) error {
+	seg.count(at, username)
+	if seg.block.Entries == 0 {
+		seg.block = LogBlock{Offset: seg.indexed(), First: at, Last: at}
+		seg.blockPlayers = map[string]bool{}
+	}
+	if at.Before(seg.block.First) {
+		seg.block.First = at
+	}
+	if at.After(seg.block.Last) {
+		seg.block.Last = at
+	}
+	seg.block.Size = end - seg.block.Offset
+	seg.block.Entries++
+	seg.blockPlayers[username] = true
+	if seg.block.Entries < logBlockEntries {
+		return nil
+	}
+	block := seg.currentBlock()
+	seg.blocks = append(seg.blocks, block)
+	seg.block = LogBlock{}
+	return appendBlock(seg.index, block)
+}
+
+// currentBlock returns the block being filled as it is so far.
+func (seg *segment) currentBlock() LogBlock {
+	block := seg.block
+	block.Players = slices.Sorted(maps.Keys(seg.blockPlayers))
+	return block
+}
+
+// allBlocks returns every block of the segment, including the one being
+// filled.
+func (seg *segment) allBlocks() []LogBlock {
+	blocks := slices.Clone(seg.blocks)
+	if seg.block.Entries > 0 {
+		blocks = append(blocks, seg.currentBlock())
+	}
+	return blocks
+}
+
+// addBlock adds a full block read from the index.
+func (seg *segment) addBlock(block LogBlock) {
+	seg.blocks = append(seg.blocks, block)
+	for _, username := range block.Players {
+		seg.players[username] = true
+	}
+	if seg.entries == 0 || block.First.Before(seg.first) {
+		seg.first = block.First
+	}
+	if seg.entries == 0 || block.Last.After(seg.last) {
+		seg.last = block.Last
+	}
+	seg.entries += block.Entries
+}
+
+func (seg *segment) count(at time.Time, username string) {
+	seg.players[username] = true
+	if seg.entries == 0 || at.Before(seg.first) {
+		seg.first = at
+	}
+	if seg.entries == 0 || at.After(seg.last) {
+		seg.last = at
+	}
+	seg.entries++
+}
+
+func (seg *segment) close() error {
+	return errors.Join(seg.file.Close(), seg.index.Close())
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+func (r Rotation) due(seg *segment, batchBytes int64, now time.Time) bool {
+	if seg.size == 0 {
+		return false
+	}
+	if r.MaxBytes > 0 && seg.size+batchBytes > r.MaxBytes {
+		return true
+	}
+	return r.Daily && !sameDay(seg.opened, now)
+}
+
+// rotate archives the current log and starts a new one. Whatever happens,
+// the sink is left with a log to write to unless an error is returned
+// that says otherwise.
+func (s *GameLogSink) rotate(rotation Rotation, now time.Time) error {
+	old := s.seg
+	s.settle(s.sync())
+	blocks := old.allBlocks()
+	err := old.close()
+	if err != nil {
+		return s.reopen(now, fmt.Errorf("could not close logs file: %v", err))
+	}
+
+	archive, err := archiveName(s.path, now)
+	if err != nil {
+		return s.reopen(now, err)
+	}
+	err = gzipBlocks(s.path, archive, blocks)
+	if err != nil {
+		return s.reopen(now, err)
+	}
+	err = os.Remove(s.path)
+	if err != nil {
+		return s.reopen(now, fmt.Errorf("could not remove rotated logs file: %v", err))
+	}
+	err = os.Remove(blockIndexPath(s.path))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return s.reopen(now, fmt.Errorf("could not remove rotated block index: %v", err))
+	}
+	err = s.reopen(now, nil)
+	if err != nil {
+		return err
+	}
+
+	segments, err := ReadLogIndex(s.path)
+	if err != nil {
+		return err
+	}
+	segments = append(segments, LogSegment{
+		File:    filepath.Base(archive),
+		First:   old.first,
+		Last:    old.last,
+		Entries: old.entries,
+		Players: slices.Sorted(maps.Keys(old.players)),
+	})
+	if rotation.Keep > 0 && len(segments) > rotation.Keep {
+		for _, expired := range segments[:len(segments)-rotation.Keep] {
+			path := filepath.Join(filepath.Dir(s.path), expired.File)
+			for _, name := range []string{path, blockIndexPath(path)} {
+				err := os.Remove(name)
+				if err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return fmt.Errorf("could not remove expired archive: %v", err)
+				}
+			}
+		}
+		segments = segments[len(segments)-rotation.Keep:]
+	}
+	return writeLogIndex(s.path, segments)
+}
+
+// reopen opens the log again after rotating it, or after failing to, and
+// returns cause, or the error opening the log if that failed as well.
+func (s *GameLogSink) reopen(now time.Time, cause error) error {
+	seg, err := openSegment(s.path, now)
+	if err != nil {
+		s.seg = nil
+		return errors.Join(cause, err)
+	}
+	s.seg = seg
+	return cause
+}
+
+// archiveName picks an unused name for an archive of the log rotated at
+// now.
+func archiveName(path string, now time.Time) (string, error) {
+	base := fmt.Sprintf("%s.%s", path, now.Format("20060102-150405"))
+	name := base + ".gz"
+	for i := 1; ; i++ {
+		_, err := os.Stat(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return name, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("could not name archive: %v", err)
+		}
+		name = fmt.Sprintf("%s-%d.gz", base, i)
+	}
+}
+
+// gzipBlocks writes a compressed copy of the log at src to dst, each block
+// as a gzip member of its own, along with dst's block index. Whatever
+// follows the last block, such as a line that is not a record, goes in a
+// last member that is not in the index, so that nothing in the log is
+// lost. If the blocks do not cover the log from its start, the whole log
+// goes in one member and dst has no block index. dst only appears once it
+// is complete and synced.
+func gzipBlocks(src, dst string, blocks []LogBlock) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("could not open logs file: %v", err)
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("could not open logs file: %v", err)
+	}
+	if !blocksFit(blocks, info.Size()) {
+		blocks = nil
+	}
+	var indexed int64
+	if len(blocks) > 0 {
+		indexed = blocks[len(blocks)-1].end()
+	}
+	ranges := blocks
+	if indexed < info.Size() {
+		ranges = append(slices.Clip(blocks), LogBlock{Offset: indexed, Size: info.Size() - indexed})
+	}
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("could not create archive: %v", err)
+	}
+	archived := make([]LogBlock, 0, len(blocks))
+	var offset int64
+	for i, block := range ranges {
+		zw := gzip.NewWriter(out)
+		_, err = io.Copy(zw, io.NewSectionReader(in, block.Offset, block.Size))
+		if err == nil {
+			err = zw.Close()
+		}
+		if err != nil {
+			break
+		}
+		var end int64
+		end, err = out.Seek(0, io.SeekCurrent)
+		if err != nil {
+			break
+		}
+		if i < len(blocks) {
+			block.Offset, block.Size = offset, end-offset
+			archived = append(archived, block)
+		}
+		offset = end
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("could not write archive: %v", err)
+	}
+	if len(archived) > 0 {
+		err = writeBlockIndex(dst, archived)
+		if err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,222 @@
+package gamelogic
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// encodeLogs returns logs as they are written to the log file.
+func encodeLogs(t *testing.T, logs []routing.GameLog) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, gamelog := range logs {
+		line, err := encodeLogRecord(gamelog)
+		if err != nil {
+			t.Fatalf("could not encode log: %v", err)
+		}
+		buf.Write(line)
+	}
+	return buf.Bytes()
+}
+
+func appendToFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("could not open log: %v", err)
+	}
+	defer f.Close()
+	_, err = f.Write(data)
+	if err != nil {
+		t.Fatalf("could not append to log: %v", err)
+	}
+}
+
+// writeBatches writes logs to sink size at a time, waiting for each batch
+// to be written before the next, so that the log can be rotated between
+// them.
+func writeBatches(t *testing.T, sink LogSink, logs []routing.GameLog, size int) {
+	t.Helper()
+	for start := 0; start < len(logs); start += size {
+		writeLogs(t, sink, logs[start:min(start+size, len(logs))])
+	}
+}
+
+// readArchive returns everything in the archive at path, uncompressed.
+func readArchive(t *testing.T, path string) []byte {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("could not open archive: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("could not read archive: %v", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("could not read archive: %v", err)
+	}
+	return data
+}
+
+// checkBlocks checks that the block index of the log file at path fits it
+// and that each block reads back on its own.
+func checkBlocks(t *testing.T, path string, gzipped bool) int {
+	t.Helper()
+	blocks, err := readBlockIndex(path)
+	if err != nil {
+		t.Fatalf("could not read block index: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("could not stat %s: %v", filepath.Base(path), err)
+	}
+	if !blocksFit(blocks, info.Size()) {
+		t.Fatalf("expected the block index of %s to fit it, got %+v", filepath.Base(path), blocks)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("could not open %s: %v", filepath.Base(path), err)
+	}
+	defer f.Close()
+	entries := 0
+	for _, block := range blocks {
+		records, err := readBlock(f, block, gzipped)
+		if err != nil {
+			t.Fatalf("could not read block of %s: %v", filepath.Base(path), err)
+		}
+		if len(records) != block.Entries {
+			t.Fatalf("expected a block of %s to hold %d records, got %d", filepath.Base(path), block.Entries, len(records))
+		}
+		entries += block.Entries
+	}
+	return entries
+}
+
+func TestRotationKeepsEveryLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.log")
+	logs := testLogs(testStart, 1500)
+	junk := []byte("not a record\n")
+
+	sink := newTestSink(t, path, 50, time.Hour, SyncBatch)
+	writeLogs(t, sink, logs[:300])
+	sink.Close()
+	// A line that is not a record, after the last one in the log, is in no
+	// block, and has to be archived all the same.
+	appendToFile(t, path, junk)
+
+	sink = newTestSink(t, path, 50, time.Hour, SyncBatch)
+	sink.SetRotation(Rotation{MaxBytes: 16 * 1024})
+	writeBatches(t, sink, logs[300:], 50)
+	sink.Close()
+
+	segments, err := ReadLogIndex(path)
+	if err != nil {
+		t.Fatalf("could not read log index: %v", err)
+	}
+	if len(segments) < 2 {
+		t.Fatalf("expected the log to be rotated more than once, got %d archives", len(segments))
+	}
+	var got []byte
+	entries := 0
+	for _, seg := range segments {
+		archive := filepath.Join(filepath.Dir(path), seg.File)
+		got = append(got, readArchive(t, archive)...)
+		if indexed := checkBlocks(t, archive, true); indexed != seg.Entries {
+			t.Fatalf("expected the blocks of %s to hold its %d entries, got %d", seg.File, seg.Entries, indexed)
+		}
+		entries += seg.Entries
+	}
+	live, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read log: %v", err)
+	}
+	got = append(got, live...)
+
+	want := append(encodeLogs(t, logs[:300]), junk...)
+	want = append(want, encodeLogs(t, logs[300:])...)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("expected the archives and the log to hold every line written, got %d bytes of %d", len(got), len(want))
+	}
+	entries += len(readLogFile(t, path))
+	if entries != len(logs) {
+		t.Fatalf("expected %d entries in the index and the log, got %d", len(logs), entries)
+	}
+}
+
+func TestRotationKeepsTheNewestArchives(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.log")
+	logs := testLogs(testStart, 600)
+	sink := newTestSink(t, path, 20, time.Hour, SyncBatch)
+	sink.SetRotation(Rotation{MaxBytes: 4 * 1024, Keep: 2})
+	writeBatches(t, sink, logs, 20)
+	sink.Close()
+
+	segments, err := ReadLogIndex(path)
+	if err != nil {
+		t.Fatalf("could not read log index: %v", err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("expected 2 archives in the index, got %d", len(segments))
+	}
+	archives, err := filepath.Glob(path + ".*.gz")
+	if err != nil {
+		t.Fatalf("could not list archives: %v", err)
+	}
+	if len(archives) != 2 {
+		t.Fatalf("expected the expired archives to be deleted, got %v", archives)
+	}
+	live := readLogFile(t, path)
+	kept := segments[0].Entries + segments[1].Entries + len(live)
+	want := logs[len(logs)-kept:]
+	if !segments[0].First.Equal(want[0].CurrentTime) || !segments[1].Last.Equal(live[0].CurrentTime.Add(-time.Second)) {
+		t.Fatalf("expected the archives to be the ones just before the log, got %+v", segments)
+	}
+	checkLogs(t, live, want[len(want)-len(live):])
+}
+
+func TestOpeningALogIndexesItsTail(t *testing.T) {
+	for _, name := range []string{"index behind", "index missing"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "game.log")
+			logs := testLogs(testStart, 620)
+
+			sink := newTestSink(t, path, 50, time.Hour, SyncBatch)
+			writeLogs(t, sink, logs[:300])
+			sink.Close()
+			if name == "index missing" {
+				err := os.Remove(blockIndexPath(path))
+				if err != nil {
+					t.Fatalf("could not remove block index: %v", err)
+				}
+			}
+			// Records written by a server that crashed before indexing
+			// them, and a line it was half way through.
+			appendToFile(t, path, encodeLogs(t, logs[300:610]))
+			appendToFile(t, path, []byte(`{"current_time":"2024-05-01T`))
+
+			sink = newTestSink(t, path, 5, time.Hour, SyncBatch)
+			writeLogs(t, sink, logs[610:])
+			sink.Close()
+
+			checkLogs(t, readLogFile(t, path), logs)
+			blocks, err := readBlockIndex(path)
+			if err != nil {
+				t.Fatalf("could not read block index: %v", err)
+			}
+			if len(blocks) != len(logs)/logBlockEntries {
+				t.Fatalf("expected %d full blocks in the index, got %d", len(logs)/logBlockEntries, len(blocks))
+			}
+			checkBlocks(t, path, false)
+		})
+	}
+}
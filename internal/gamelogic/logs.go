@@ -1,32 +1,84 @@
 package gamelogic
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"io/fs"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
-const logsFile = "game.log"
+var logsFile = "game.log"
 
-const writeToDiskSleep = 1 * time.Second
+// SetLogPath changes the file game logs are written to and read from.
+func SetLogPath(path string) {
+	logsFile = path
+}
+
+func formatLog(gamelog routing.GameLog) string {
+	return fmt.Sprintf("%v %v: %v\n", gamelog.CurrentTime.Format(time.RFC3339), gamelog.Username, gamelog.Message)
+}
 
-func WriteLog(gamelog routing.GameLog) error {
-	log.Printf("received game log...")
-	time.Sleep(writeToDiskSleep)
+// tailChunk is how much of the log TailLog reads at a time, working back
+// from the end.
+const tailChunk = 64 * 1024
 
-	f, err := os.OpenFile(logsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// TailLog returns up to the last n lines of the game log as text, oldest
+// first. A missing log has no lines. Only the end of the log is read,
+// however big it is.
+func TailLog(n int) ([]string, error) {
+	f, err := os.Open(logsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
 	if err != nil {
-		return fmt.Errorf("could not open logs file: %v", err)
+		return nil, fmt.Errorf("could not open logs file: %v", err)
 	}
 	defer f.Close()
 
-	str := fmt.Sprintf("%v %v: %v\n", gamelog.CurrentTime.Format(time.RFC3339), gamelog.Username, gamelog.Message)
-	_, err = f.WriteString(str)
+	end, err := f.Seek(0, io.SeekEnd)
 	if err != nil {
-		return fmt.Errorf("could not write to logs file: %v", err)
+		return nil, fmt.Errorf("could not read logs file: %v", err)
+	}
+	lines := []string{}
+	// partial is the start of the earliest line read so far, which may
+	// carry on in the chunk before it.
+	var partial []byte
+	for end > 0 && len(lines) < n {
+		size := min(end, tailChunk)
+		end -= size
+		chunk := make([]byte, size, size+int64(len(partial)))
+		_, err := f.ReadAt(chunk, end)
+		if err != nil {
+			return nil, fmt.Errorf("could not read logs file: %v", err)
+		}
+		parts := bytes.Split(append(chunk, partial...), []byte("\n"))
+		partial = parts[0]
+		for i := len(parts) - 1; i > 0 && len(lines) < n; i-- {
+			if len(parts[i]) > 0 {
+				lines = append(lines, tailLine(parts[i]))
+			}
+		}
+	}
+	if end == 0 && len(partial) > 0 && len(lines) < n {
+		lines = append(lines, tailLine(partial))
+	}
+	slices.Reverse(lines)
+	return lines, nil
+}
+
+// tailLine formats a line of the log the way formatLog does, or returns it
+// as it is if it is not a record.
+func tailLine(line []byte) string {
+	gamelog, ok := decodeLogRecord(line)
+	if !ok {
+		return string(line)
 	}
-	return nil
+	return strings.TrimSuffix(formatLog(gamelog), "\n")
 }
@@ -0,0 +1,319 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+const (
+	DefaultLogLimit = 20
+	MaxLogLimit     = 500
+)
+
+// LogQuery picks game logs. Empty fields match everything.
+type LogQuery struct {
+	Username string
+	// Since is inclusive and Until exclusive.
+	Since time.Time
+	Until time.Time
+	// Text is looked for in the message, ignoring case.
+	Text   string
+	Offset int
+	Limit  int
+}
+
+// LogPage is one page of the logs matching a query, newest first.
+type LogPage struct {
+	Logs   []routing.GameLog `json:"logs"`
+	Total  int               `json:"total"`
+	Offset int               `json:"offset"`
+	Limit  int               `json:"limit"`
+}
+
+func (q LogQuery) Validate() error {
+	if q.Offset < 0 {
+		return fmt.Errorf("error: offset must be 0 or more, got %d", q.Offset)
+	}
+	if q.Limit < 1 || q.Limit > MaxLogLimit {
+		return fmt.Errorf("error: limit must be between 1 and %d, got %d", MaxLogLimit, q.Limit)
+	}
+	return nil
+}
+
+func (q LogQuery) matches(gamelog routing.GameLog) bool {
+	if q.Username != "" && gamelog.Username != q.Username {
+		return false
+	}
+	if gamelog.CurrentTime.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !gamelog.CurrentTime.Before(q.Until) {
+		return false
+	}
+	return q.Text == "" || strings.Contains(strings.ToLower(gamelog.Message), strings.ToLower(q.Text))
+}
+
+// covers reports whether an archive may hold logs matching the query,
+// going by the index.
+func (q LogQuery) covers(seg LogSegment) bool {
+	if seg.Entries == 0 || seg.Last.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !seg.First.Before(q.Until) {
+		return false
+	}
+	return q.Username == "" || seg.Players == nil || slices.Contains(seg.Players, q.Username)
+}
+
+// coversBlock reports whether a block may hold logs matching the query.
+func (q LogQuery) coversBlock(block LogBlock) bool {
+	if block.Entries == 0 || block.Last.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !block.First.Before(q.Until) {
+		return false
+	}
+	return q.Username == "" || slices.Contains(block.Players, q.Username)
+}
+
+// matchesBlock reports whether every log in a block matches the query, so
+// that they can be counted without reading them.
+func (q LogQuery) matchesBlock(block LogBlock) bool {
+	if q.Text != "" || block.First.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !block.Last.Before(q.Until) {
+		return false
+	}
+	return q.Username == "" || slices.Equal(block.Players, []string{q.Username})
+}
+
+// SearchLogs finds the game logs matching q in the log and its archives.
+// Files and blocks the indexes rule out are not read, and blocks the
+// indexes show match in full are only read if they are on the page.
+func SearchLogs(q LogQuery) (LogPage, error) {
+	err := q.Validate()
+	if err != nil {
+		return LogPage{}, err
+	}
+	segments, err := ReadLogIndex(logsFile)
+	if err != nil {
+		return LogPage{}, err
+	}
+
+	s := &logSearch{q: q, keep: q.Offset + q.Limit, matches: []routing.GameLog{}}
+	err = s.searchLog(logsFile)
+	if err != nil {
+		return LogPage{}, err
+	}
+	for i := len(segments) - 1; i >= 0; i-- {
+		if !q.covers(segments[i]) {
+			continue
+		}
+		err := s.searchArchive(filepath.Join(filepath.Dir(logsFile), segments[i].File))
+		if err != nil {
+			return LogPage{}, err
+		}
+	}
+
+	page := LogPage{
+		Logs:   []routing.GameLog{},
+		Total:  s.total,
+		Offset: q.Offset,
+		Limit:  q.Limit,
+	}
+	if q.Offset < len(s.matches) {
+		page.Logs = s.matches[q.Offset:]
+	}
+	return page, nil
+}
+
+// logSearch goes through the logs newest first, counting every match but
+// only keeping the ones up to the end of the page.
+type logSearch struct {
+	q       LogQuery
+	keep    int
+	total   int
+	matches []routing.GameLog
+}
+
+// searchLog searches the live log. The records after its last full block
+// are not indexed yet, so they are all read.
+func (s *logSearch) searchLog(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not open logs file: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("could not open logs file: %v", err)
+	}
+	blocks, err := readBlockIndex(path)
+	if err != nil || !blocksFit(blocks, info.Size()) {
+		// The index is rebuilt when the server next opens the log.
+		blocks = nil
+	}
+
+	var indexed int64
+	if len(blocks) > 0 {
+		indexed = blocks[len(blocks)-1].end()
+	}
+	tail, err := readBlock(f, LogBlock{Offset: indexed, Size: info.Size() - indexed}, false)
+	if err != nil {
+		return err
+	}
+	s.add(tail, false)
+	return s.searchBlocks(f, blocks, false)
+}
+
+// searchArchive searches an archive. Archives can be deleted by the
+// server between reading the index and opening them, and those are
+// skipped. Archives rotated before blocks were indexed are read whole.
+func (s *logSearch) searchArchive(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not open archive: %v", err)
+	}
+	defer f.Close()
+	blocks, err := readBlockIndex(path)
+	if err != nil {
+		return err
+	}
+	if blocks != nil {
+		return s.searchBlocks(f, blocks, true)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("could not open archive: %v", err)
+	}
+	if info.Size() == 0 {
+		return nil
+	}
+	records, err := readBlock(f, LogBlock{Size: info.Size()}, true)
+	if err != nil {
+		return fmt.Errorf("could not read archive %s: %v", filepath.Base(path), err)
+	}
+	s.add(records, false)
+	return nil
+}
+
+func (s *logSearch) searchBlocks(f *os.File, blocks []LogBlock, gzipped bool) error {
+	for i := len(blocks) - 1; i >= 0; i-- {
+		block := blocks[i]
+		if !s.q.coversBlock(block) {
+			continue
+		}
+		whole := s.q.matchesBlock(block)
+		if whole {
+			s.total += block.Entries
+			if len(s.matches) >= s.keep {
+				continue
+			}
+		}
+		records, err := readBlock(f, block, gzipped)
+		if err != nil {
+			return fmt.Errorf("could not read %s: %v", filepath.Base(f.Name()), err)
+		}
+		s.add(records, whole)
+	}
+	return nil
+}
+
+// add goes through records, oldest first as they are in the log, from the
+// newest. whole says they all match and have already been counted.
+func (s *logSearch) add(records []routing.GameLog, whole bool) {
+	for i := len(records) - 1; i >= 0; i-- {
+		if !whole {
+			if !s.q.matches(records[i]) {
+				continue
+			}
+			s.total++
+		}
+		if len(s.matches) < s.keep {
+			s.matches = append(s.matches, records[i])
+		}
+	}
+}
+
+// ParseLogTime reads a time given either in RFC 3339 or as a duration
+// before now, such as 90m.
+func ParseLogTime(s string, now time.Time) (time.Time, error) {
+	at, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return at, nil
+	}
+	ago, err := time.ParseDuration(s)
+	if err == nil && ago >= 0 {
+		return now.Add(-ago), nil
+	}
+	return time.Time{}, fmt.Errorf("error: %s is not a valid time, use RFC 3339 or a duration such as 90m", s)
+}
+
+// ParseLogQuery reads the arguments of the logs command:
+//
+//	logs [player=<username>] [since=<time>] [until=<time>] [page=<n>] [text...]
+//
+// Any other words are text to search for.
+func ParseLogQuery(words []string, now time.Time) (LogQuery, error) {
+	q := LogQuery{Limit: DefaultLogLimit}
+	text := []string{}
+	for _, word := range words[1:] {
+		key, value, ok := strings.Cut(word, "=")
+		var err error
+		switch {
+		case ok && key == "player":
+			q.Username = value
+		case ok && key == "since":
+			q.Since, err = ParseLogTime(value, now)
+		case ok && key == "until":
+			q.Until, err = ParseLogTime(value, now)
+		case ok && key == "page":
+			page, convErr := strconv.Atoi(value)
+			if convErr != nil || page < 1 {
+				err = fmt.Errorf("error: %s is not a valid page", value)
+			}
+			q.Offset = (page - 1) * q.Limit
+		default:
+			text = append(text, word)
+		}
+		if err != nil {
+			return LogQuery{}, err
+		}
+	}
+	q.Text = strings.Join(text, " ")
+	return q, nil
+}
+
+// PrintLogs prints a page of search results, oldest first so that it reads
+// like the log itself.
+func PrintLogs(page LogPage) {
+	if page.Total == 0 {
+		fmt.Println("No game logs match.")
+		return
+	}
+	pages := (page.Total + page.Limit - 1) / page.Limit
+	if len(page.Logs) == 0 {
+		fmt.Printf("There are only %d pages of matching logs.\n", pages)
+		return
+	}
+	for i := len(page.Logs) - 1; i >= 0; i-- {
+		fmt.Print(formatLog(page.Logs[i]))
+	}
+	fmt.Printf("Page %d of %d, %d matching logs.\n", page.Offset/page.Limit+1, pages, page.Total)
+}
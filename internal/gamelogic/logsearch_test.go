@@ -0,0 +1,88 @@
+package gamelogic
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// searchAll is what SearchLogs should find for q in logs, which are
+// oldest first.
+func searchAll(q LogQuery, logs []routing.GameLog) LogPage {
+	page := LogPage{Logs: []routing.GameLog{}, Offset: q.Offset, Limit: q.Limit}
+	for i := len(logs) - 1; i >= 0; i-- {
+		gamelog := logs[i]
+		if q.Username != "" && gamelog.Username != q.Username {
+			continue
+		}
+		if gamelog.CurrentTime.Before(q.Since) || (!q.Until.IsZero() && !gamelog.CurrentTime.Before(q.Until)) {
+			continue
+		}
+		if !strings.Contains(strings.ToLower(gamelog.Message), strings.ToLower(q.Text)) {
+			continue
+		}
+		if page.Total >= q.Offset && page.Total < q.Offset+q.Limit {
+			page.Logs = append(page.Logs, gamelog)
+		}
+		page.Total++
+	}
+	return page
+}
+
+func TestSearchLogsAcrossSegments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.log")
+	old := logsFile
+	SetLogPath(path)
+	t.Cleanup(func() { SetLogPath(old) })
+
+	logs := testLogs(testStart, 2000)
+	// A run of logs from one player fills whole blocks, which searches for
+	// them count without reading.
+	for i := 1000; i < 1700; i++ {
+		logs[i].Username = "dave"
+	}
+	sink := newTestSink(t, path, 100, time.Hour, SyncBatch)
+	sink.SetRotation(Rotation{MaxBytes: 48 * 1024})
+	writeBatches(t, sink, logs, 100)
+	sink.Close()
+
+	segments, err := ReadLogIndex(path)
+	if err != nil {
+		t.Fatalf("could not read log index: %v", err)
+	}
+	if len(segments) < 2 {
+		t.Fatalf("expected the logs to span several archives, got %d", len(segments))
+	}
+
+	at := func(i int) time.Time {
+		return logs[i].CurrentTime
+	}
+	queries := map[string]LogQuery{
+		"newest":              {Limit: 20},
+		"one player":          {Username: "alice", Offset: 30, Limit: 50},
+		"whole blocks":        {Username: "dave", Limit: MaxLogLimit},
+		"whole blocks paged":  {Username: "dave", Offset: 300, Limit: 100},
+		"time window":         {Username: "dave", Since: at(1100), Until: at(1500), Offset: 5, Limit: 10},
+		"text":                {Text: "MOVE 17", Limit: MaxLogLimit},
+		"live log only":       {Since: at(1990), Limit: 20},
+		"oldest":              {Until: at(10), Limit: 20},
+		"past the last match": {Username: "carol", Offset: 1000, Limit: 20},
+		"no matches":          {Username: "nobody", Limit: 10},
+	}
+	for name, q := range queries {
+		t.Run(name, func(t *testing.T) {
+			got, err := SearchLogs(q)
+			if err != nil {
+				t.Fatalf("could not search logs: %v", err)
+			}
+			want := searchAll(q, logs)
+			if got.Total != want.Total {
+				t.Fatalf("expected %d matches, got %d", want.Total, got.Total)
+			}
+			checkLogs(t, got.Logs, want.Logs)
+		})
+	}
+}
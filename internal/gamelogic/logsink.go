@@ -0,0 +1,274 @@
+package gamelogic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// SyncPolicy decides when a GameLogSink asks the OS to put what it has
+// written on disk. An entry only counts as written once it has been
+// synced, unless the policy is SyncNever.
+type SyncPolicy string
+
+const (
+	// SyncBatch syncs after every batch.
+	SyncBatch SyncPolicy = "batch"
+	// SyncInterval syncs once per flush interval, so entries in batches
+	// that filled up in between wait for it.
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves syncing to the OS. Entries survive the server
+	// crashing but not the machine.
+	SyncNever SyncPolicy = "never"
+)
+
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch policy := SyncPolicy(s); policy {
+	case SyncBatch, SyncInterval, SyncNever:
+		return policy, nil
+	}
+	return "", fmt.Errorf("error: %s is not a valid sync policy", s)
+}
+
+var errSinkClosed = errors.New("game log sink is closed")
+
+// GameLogSink appends game logs to a file in batches. A batch is written
+// once it has batchSize entries or the flush interval passes, whichever is
+// first, and each entry's done func is called once its batch is written
+// and synced according to the policy, so the message it came from can be
+// acked then and not before. The log is rotated as SetRotation says.
+type GameLogSink struct {
+	path      string
+	batchSize int
+	policy    SyncPolicy
+	pending   []pendingLog
+	rotation  Rotation
+	closed    bool
+	mu        *sync.Mutex
+	// seg and unsynced are only used by the flushing goroutine once it
+	// has started.
+	seg      *segment
+	unsynced []func(error)
+	full     chan struct{}
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+type pendingLog struct {
+	line     []byte
+	at       time.Time
+	username string
+	done     func(error)
+}
+
+func NewGameLogSink(path string, batchSize int, flushEvery time.Duration, policy SyncPolicy) (*GameLogSink, error) {
+	if batchSize < 1 {
+		return nil, fmt.Errorf("error: batch size must be at least 1, got %d", batchSize)
+	}
+	if flushEvery <= 0 {
+		return nil, fmt.Errorf("error: flush interval must be positive, got %s", flushEvery)
+	}
+	seg, err := openSegment(path, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	s := &GameLogSink{
+		path:      path,
+		seg:       seg,
+		batchSize: batchSize,
+		policy:    policy,
+		mu:        &sync.Mutex{},
+		full:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go s.run(flushEvery)
+	return s, nil
+}
+
+// SetRotation changes when the log is rotated from the next batch on. By
+// default it never is.
+func (s *GameLogSink) SetRotation(rotation Rotation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotation = rotation
+}
+
+// Write queues gamelog to be written and calls done once it has been, or
+// with the error that stopped it.
+func (s *GameLogSink) Write(gamelog routing.GameLog, done func(error)) {
+	line, err := encodeLogRecord(gamelog)
+	if err != nil {
+		done(err)
+		return
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		done(errSinkClosed)
+		return
+	}
+	s.pending = append(s.pending, pendingLog{
+		line:     line,
+		at:       gamelog.CurrentTime,
+		username: gamelog.Username,
+		done:     done,
+	})
+	full := len(s.pending) >= s.batchSize
+	s.mu.Unlock()
+	if full {
+		select {
+		case s.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close writes and syncs whatever is queued and closes the file.
+func (s *GameLogSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+	close(s.stop)
+	<-s.stopped
+	if s.seg == nil {
+		return nil
+	}
+	return s.seg.close()
+}
+
+func (s *GameLogSink) run(flushEvery time.Duration) {
+	defer close(s.stopped)
+	ticker := time.NewTicker(flushEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.full:
+			s.flush(false)
+		case <-ticker.C:
+			s.flush(true)
+		case <-s.stop:
+			s.flush(true)
+			return
+		}
+	}
+}
+
+// flush writes the pending entries. tick is set when the flush interval
+// has passed, which is when the interval policy syncs.
+func (s *GameLogSink) flush(tick bool) {
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = nil
+	rotation := s.rotation
+	s.mu.Unlock()
+
+	if len(batch) > 0 {
+		var buf bytes.Buffer
+		for _, entry := range batch {
+			buf.Write(entry.line)
+		}
+		err := s.write(rotation, buf.Bytes())
+		if err != nil {
+			for _, entry := range batch {
+				entry.done(err)
+			}
+			return
+		}
+		// The index is only there to speed up searches, and is rebuilt
+		// when the log is next opened if it falls behind, so failing to
+		// write it does not fail the batch.
+		end := s.seg.size - int64(buf.Len())
+		for _, entry := range batch {
+			end += int64(len(entry.line))
+			err := s.seg.record(entry.at, entry.username, end)
+			if err != nil {
+				slog.Error("could not index game logs", "err", err)
+			}
+			s.unsynced = append(s.unsynced, entry.done)
+		}
+		slog.Debug("wrote game logs", "entries", len(batch))
+	}
+	if len(s.unsynced) == 0 {
+		return
+	}
+
+	switch s.policy {
+	case SyncNever:
+		s.settle(nil)
+	case SyncInterval:
+		if tick {
+			s.settle(s.sync())
+		}
+	default:
+		s.settle(s.sync())
+	}
+}
+
+// write appends a batch to the log, rotating it first if it is due. A log
+// that could not be rotated is written to as it is.
+func (s *GameLogSink) write(rotation Rotation, batch []byte) error {
+	now := time.Now()
+	if s.seg != nil && rotation.due(s.seg, int64(len(batch)), now) {
+		err := s.rotate(rotation, now)
+		if err != nil {
+			slog.Error("could not rotate game log", "err", err)
+		}
+	}
+	if s.seg == nil {
+		seg, err := openSegment(s.path, now)
+		if err != nil {
+			return err
+		}
+		s.seg = seg
+	}
+	_, err := s.seg.file.Write(batch)
+	if err != nil {
+		s.unwrite()
+		return fmt.Errorf("could not write to logs file: %v", err)
+	}
+	s.seg.size += int64(len(batch))
+	return nil
+}
+
+// unwrite cuts off whatever part of a failed batch made it into the log, so
+// that the batch can be written again without leaving half a record in
+// front of it. If that fails too the log is closed, to be opened and read
+// back again before the next batch.
+func (s *GameLogSink) unwrite() {
+	err := s.seg.file.Truncate(s.seg.size)
+	if err == nil {
+		return
+	}
+	slog.Error("could not cut a failed write off the game log", "err", err)
+	s.settle(s.sync())
+	s.seg.close()
+	s.seg = nil
+}
+
+func (s *GameLogSink) sync() error {
+	if s.seg == nil {
+		return errors.New("could not sync logs file: it is not open")
+	}
+	err := s.seg.file.Sync()
+	if err != nil {
+		return fmt.Errorf("could not sync logs file: %v", err)
+	}
+	return nil
+}
+
+func (s *GameLogSink) settle(err error) {
+	for _, done := range s.unsynced {
+		done(err)
+	}
+	s.unsynced = nil
+}
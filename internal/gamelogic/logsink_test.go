@@ -0,0 +1,182 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+var testPlayers = []string{"alice", "bob", "carol"}
+
+// testLogs returns n game logs a second apart, starting at start, from the
+// test players in turn.
+func testLogs(start time.Time, n int) []routing.GameLog {
+	logs := make([]routing.GameLog, n)
+	for i := range logs {
+		logs[i] = routing.GameLog{
+			CurrentTime: start.Add(time.Duration(i) * time.Second),
+			Username:    testPlayers[i%len(testPlayers)],
+			Message:     fmt.Sprintf("move %d to europe", i),
+		}
+	}
+	return logs
+}
+
+var testStart = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestSink(t *testing.T, path string, batchSize int, flushEvery time.Duration, policy SyncPolicy) *GameLogSink {
+	t.Helper()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	sink, err := NewGameLogSink(path, batchSize, flushEvery, policy)
+	if err != nil {
+		t.Fatalf("could not open sink: %v", err)
+	}
+	t.Cleanup(func() { sink.Close() })
+	return sink
+}
+
+// writeLogs writes logs to sink and waits for every one of them to be done.
+func writeLogs(t *testing.T, sink LogSink, logs []routing.GameLog) {
+	t.Helper()
+	errs := make(chan error, len(logs))
+	for _, gamelog := range logs {
+		sink.Write(gamelog, func(err error) { errs <- err })
+	}
+	for range logs {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatalf("could not write log: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for logs to be written")
+		}
+	}
+}
+
+// readLogFile returns the records in the log file at path.
+func readLogFile(t *testing.T, path string) []routing.GameLog {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("could not open log: %v", err)
+	}
+	defer f.Close()
+	records := []routing.GameLog{}
+	err = readRecords(f, func(gamelog routing.GameLog, _ int64) {
+		records = append(records, gamelog)
+	})
+	if err != nil {
+		t.Fatalf("could not read log: %v", err)
+	}
+	return records
+}
+
+func checkLogs(t *testing.T, got, want []routing.GameLog) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d logs, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if !got[i].CurrentTime.Equal(want[i].CurrentTime) || got[i].Username != want[i].Username || got[i].Message != want[i].Message {
+			t.Fatalf("expected log %d to be %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestGameLogSinkWritesFullBatchesWithoutWaiting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.log")
+	sink := newTestSink(t, path, 10, time.Hour, SyncBatch)
+	logs := testLogs(testStart, 30)
+	// The flush interval is an hour, so the logs are only written in time
+	// if full batches go out on their own.
+	writeLogs(t, sink, logs)
+	checkLogs(t, readLogFile(t, path), logs)
+}
+
+func TestGameLogSinkWritesPartBatchesOnTheInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.log")
+	sink := newTestSink(t, path, 100, 10*time.Millisecond, SyncBatch)
+	logs := testLogs(testStart, 3)
+	writeLogs(t, sink, logs)
+	checkLogs(t, readLogFile(t, path), logs)
+}
+
+func TestGameLogSinkSyncPolicies(t *testing.T) {
+	for _, policy := range []SyncPolicy{SyncBatch, SyncInterval, SyncNever} {
+		t.Run(string(policy), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "game.log")
+			sink := newTestSink(t, path, 5, 20*time.Millisecond, policy)
+			logs := testLogs(testStart, 12)
+			writeLogs(t, sink, logs)
+			checkLogs(t, readLogFile(t, path), logs)
+		})
+	}
+}
+
+func TestGameLogSinkIntervalPolicyWaitsForTheInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.log")
+	sink := newTestSink(t, path, 1, time.Hour, SyncInterval)
+	done := make(chan error, 1)
+	sink.Write(testLogs(testStart, 1)[0], func(err error) { done <- err })
+	select {
+	case err := <-done:
+		t.Fatalf("expected the log to wait for the interval to be synced, got done with %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// Closing syncs whatever is still waiting.
+	err := sink.Close()
+	if err != nil {
+		t.Fatalf("could not close sink: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected the log to be written, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected closing the sink to finish the log")
+	}
+}
+
+func TestGameLogSinkWritesQueuedLogsOnClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.log")
+	sink := newTestSink(t, path, 100, time.Hour, SyncBatch)
+	logs := testLogs(testStart, 7)
+	var wg sync.WaitGroup
+	wg.Add(len(logs))
+	for _, gamelog := range logs {
+		sink.Write(gamelog, func(error) { wg.Done() })
+	}
+	err := sink.Close()
+	if err != nil {
+		t.Fatalf("could not close sink: %v", err)
+	}
+	wg.Wait()
+	checkLogs(t, readLogFile(t, path), logs)
+
+	var closedErr error
+	sink.Write(logs[0], func(err error) { closedErr = err })
+	if !errors.Is(closedErr, errSinkClosed) {
+		t.Fatalf("expected a write after closing to fail, got %v", closedErr)
+	}
+}
+
+func TestGameLogSinkAppendsToAnExistingLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.log")
+	logs := testLogs(testStart, 20)
+	sink := newTestSink(t, path, 4, time.Hour, SyncBatch)
+	writeLogs(t, sink, logs[:8])
+	sink.Close()
+	sink = newTestSink(t, path, 4, time.Hour, SyncBatch)
+	writeLogs(t, sink, logs[8:])
+	checkLogs(t, readLogFile(t, path), logs)
+}
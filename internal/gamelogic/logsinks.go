@@ -0,0 +1,261 @@
+package gamelogic
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// LogSink stores game logs. Write calls done once the log is stored, or
+// with the error that stopped it, and may do so after it has returned.
+// GameLogSink is the usual one.
+type LogSink interface {
+	Write(gamelog routing.GameLog, done func(error))
+	Close() error
+}
+
+// WriteAndWait writes gamelog to sink and waits until it has been stored.
+func WriteAndWait(sink LogSink, gamelog routing.GameLog) error {
+	errCh := make(chan error, 1)
+	sink.Write(gamelog, func(err error) {
+		errCh <- err
+	})
+	return <-errCh
+}
+
+// LogFilter picks logs by player and by a pattern in the message. Empty
+// fields match everything.
+type LogFilter struct {
+	Username string
+	Match    *regexp.Regexp
+}
+
+func (f LogFilter) Matches(gamelog routing.GameLog) bool {
+	if f.Username != "" && gamelog.Username != f.Username {
+		return false
+	}
+	return f.Match == nil || f.Match.MatchString(gamelog.Message)
+}
+
+type filteredSink struct {
+	sink   LogSink
+	filter LogFilter
+}
+
+// Filter passes on to sink only the logs that match filter. The rest are
+// done with straight away.
+func Filter(sink LogSink, filter LogFilter) LogSink {
+	return filteredSink{sink: sink, filter: filter}
+}
+
+func (s filteredSink) Write(gamelog routing.GameLog, done func(error)) {
+	if !s.filter.Matches(gamelog) {
+		done(nil)
+		return
+	}
+	s.sink.Write(gamelog, done)
+}
+
+func (s filteredSink) Close() error {
+	return s.sink.Close()
+}
+
+type fanout []LogSink
+
+// Fanout writes every log to each of sinks, and is done with it once they
+// all are. If any of them fails, the error is passed on, and a log that is
+// written again because of it will be written again to every sink.
+func Fanout(sinks ...LogSink) LogSink {
+	return fanout(sinks)
+}
+
+func (f fanout) Write(gamelog routing.GameLog, done func(error)) {
+	if len(f) == 0 {
+		done(nil)
+		return
+	}
+	mu := &sync.Mutex{}
+	remaining := len(f)
+	errs := []error{}
+	for _, sink := range f {
+		sink.Write(gamelog, func(err error) {
+			mu.Lock()
+			if err != nil {
+				errs = append(errs, err)
+			}
+			remaining--
+			last := remaining == 0
+			mu.Unlock()
+			if last {
+				done(errors.Join(errs...))
+			}
+		})
+	}
+}
+
+func (f fanout) Close() error {
+	errs := []error{}
+	for _, sink := range f {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// writerSink writes each log as soon as it gets it, without batching.
+type writerSink struct {
+	w    io.Writer
+	json bool
+	mu   *sync.Mutex
+}
+
+// NewWriterSink writes logs to w, as text lines like the game log or, with
+// the json format, as one JSON object per line.
+func NewWriterSink(w io.Writer, format string) (LogSink, error) {
+	if format != "text" && format != "json" {
+		return nil, fmt.Errorf("error: %s is not a valid log format", format)
+	}
+	return &writerSink{w: w, json: format == "json", mu: &sync.Mutex{}}, nil
+}
+
+func (s *writerSink) Write(gamelog routing.GameLog, done func(error)) {
+	line, err := s.format(gamelog)
+	if err != nil {
+		done(err)
+		return
+	}
+	s.mu.Lock()
+	_, err = s.w.Write(line)
+	s.mu.Unlock()
+	done(err)
+}
+
+func (s *writerSink) format(gamelog routing.GameLog) ([]byte, error) {
+	if s.json {
+		return encodeLogRecord(gamelog)
+	}
+	return []byte(formatLog(gamelog)), nil
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
+
+// jsonLinesSink appends logs to a file as one JSON object per line. Each
+// log is written as soon as it arrives, but only done once it has been
+// synced as the policy says, like the game log. Logs written while a sync
+// is under way are synced together by the next one.
+type jsonLinesSink struct {
+	file     *os.File
+	policy   SyncPolicy
+	unsynced []func(error)
+	closed   bool
+	mu       *sync.Mutex
+	written  chan struct{}
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// NewJSONLinesSink appends logs to the file at path, syncing them as
+// policy says, where syncEvery is the interval of SyncInterval.
+func NewJSONLinesSink(path string, policy SyncPolicy, syncEvery time.Duration) (LogSink, error) {
+	if syncEvery <= 0 {
+		return nil, fmt.Errorf("error: sync interval must be positive, got %s", syncEvery)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %v", path, err)
+	}
+	s := &jsonLinesSink{
+		file:    f,
+		policy:  policy,
+		mu:      &sync.Mutex{},
+		written: make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.run(syncEvery)
+	return s, nil
+}
+
+func (s *jsonLinesSink) Write(gamelog routing.GameLog, done func(error)) {
+	line, err := encodeLogRecord(gamelog)
+	if err != nil {
+		done(err)
+		return
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		done(errSinkClosed)
+		return
+	}
+	_, err = s.file.Write(line)
+	if err != nil || s.policy == SyncNever {
+		s.mu.Unlock()
+		done(err)
+		return
+	}
+	s.unsynced = append(s.unsynced, done)
+	s.mu.Unlock()
+	select {
+	case s.written <- struct{}{}:
+	default:
+	}
+}
+
+func (s *jsonLinesSink) run(syncEvery time.Duration) {
+	defer close(s.stopped)
+	ticker := time.NewTicker(syncEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.written:
+			if s.policy == SyncBatch {
+				s.sync()
+			}
+		case <-ticker.C:
+			s.sync()
+		case <-s.stop:
+			s.sync()
+			return
+		}
+	}
+}
+
+// sync syncs the file and settles every log written before it started.
+func (s *jsonLinesSink) sync() {
+	s.mu.Lock()
+	unsynced := s.unsynced
+	s.unsynced = nil
+	s.mu.Unlock()
+	if len(unsynced) == 0 {
+		return
+	}
+	err := s.file.Sync()
+	if err != nil {
+		err = fmt.Errorf("could not sync %s: %v", s.file.Name(), err)
+	}
+	for _, done := range unsynced {
+		done(err)
+	}
+}
+
+// Close syncs whatever has been written and closes the file.
+func (s *jsonLinesSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+	close(s.stop)
+	<-s.stopped
+	return s.file.Close()
+}
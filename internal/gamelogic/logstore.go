@@ -0,0 +1,207 @@
+package gamelogic
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// The game log holds one JSON record per line, so that every log reads
+// back exactly as it was written, whatever is in its message. Next to each
+// log file, live or archived, is a block index at <file>.blocks with one
+// JSON line per run of logBlockEntries records: where the run is in the
+// file, the times it covers and the players with entries in it. Searches
+// use it to skip the runs that cannot match and to count the ones that
+// all do without reading them. Archives are gzipped a block at a time, so
+// that any block can be read on its own.
+
+// logBlockEntries is how many records make up a block.
+const logBlockEntries = 256
+
+// LogBlock is a run of consecutive records in a log file.
+type LogBlock struct {
+	// Offset and Size are where the block is in its file. In an archive
+	// they are where the gzip member holding it is.
+	Offset  int64     `json:"offset"`
+	Size    int64     `json:"size"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+	Entries int       `json:"entries"`
+	Players []string  `json:"players"`
+}
+
+func (b LogBlock) end() int64 {
+	return b.Offset + b.Size
+}
+
+func blockIndexPath(path string) string {
+	return path + ".blocks"
+}
+
+func encodeLogRecord(gamelog routing.GameLog) ([]byte, error) {
+	data, err := json.Marshal(gamelog)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// decodeLogRecord reads back a line of the game log. Logs written before
+// records were stored as JSON are text lines, which are read as well as
+// they can be.
+func decodeLogRecord(line []byte) (routing.GameLog, bool) {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	if len(line) > 0 && line[0] == '{' {
+		var gamelog routing.GameLog
+		err := json.Unmarshal(line, &gamelog)
+		return gamelog, err == nil
+	}
+	return parseTextLogLine(string(line))
+}
+
+// parseTextLogLine reads back a line written by formatLog.
+func parseTextLogLine(line string) (routing.GameLog, bool) {
+	stamp, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return routing.GameLog{}, false
+	}
+	at, err := time.Parse(time.RFC3339, stamp)
+	if err != nil {
+		return routing.GameLog{}, false
+	}
+	username, message, ok := strings.Cut(rest, ": ")
+	if !ok {
+		return routing.GameLog{}, false
+	}
+	return routing.GameLog{
+		CurrentTime: at,
+		Username:    username,
+		Message:     message,
+	}, true
+}
+
+// readRecords calls fn for each record in r, along with the offset in r
+// just past it. Lines that are not records, such as one still being
+// written, are skipped.
+func readRecords(r io.Reader, fn func(gamelog routing.GameLog, end int64)) error {
+	br := bufio.NewReader(r)
+	var end int64
+	for {
+		line, err := br.ReadBytes('\n')
+		end += int64(len(line))
+		if len(line) > 0 {
+			gamelog, ok := decodeLogRecord(line)
+			if ok {
+				fn(gamelog, end)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read logs: %v", err)
+		}
+	}
+}
+
+// readBlock returns the records in a block of f, oldest first.
+func readBlock(f *os.File, block LogBlock, gzipped bool) ([]routing.GameLog, error) {
+	var r io.Reader = io.NewSectionReader(f, block.Offset, block.Size)
+	if gzipped {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("could not read archive: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	records := []routing.GameLog{}
+	err := readRecords(r, func(gamelog routing.GameLog, _ int64) {
+		records = append(records, gamelog)
+	})
+	return records, err
+}
+
+// readBlockIndex returns the blocks of the log file at path, oldest first,
+// or none if it has no index. A last line without its newline is still
+// being written and is left out.
+func readBlockIndex(path string) ([]LogBlock, error) {
+	f, err := os.Open(blockIndexPath(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open block index: %v", err)
+	}
+	defer f.Close()
+	blocks := []LogBlock{}
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return blocks, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read block index: %v", err)
+		}
+		var block LogBlock
+		err = json.Unmarshal(line, &block)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse block index: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+}
+
+// blocksFit reports whether blocks could index a log file of size bytes:
+// they must follow on from each other from the start of the file.
+func blocksFit(blocks []LogBlock, size int64) bool {
+	var end int64
+	for _, block := range blocks {
+		if block.Offset != end || block.Size <= 0 {
+			return false
+		}
+		end = block.end()
+	}
+	return end <= size
+}
+
+func appendBlock(w io.Writer, block LogBlock) error {
+	data, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("could not write block index: %v", err)
+	}
+	return nil
+}
+
+// writeBlockIndex replaces the block index of the log file at path in one
+// step.
+func writeBlockIndex(path string, blocks []LogBlock) error {
+	var buf bytes.Buffer
+	for _, block := range blocks {
+		err := appendBlock(&buf, block)
+		if err != nil {
+			return err
+		}
+	}
+	tmp := blockIndexPath(path) + ".tmp"
+	err := os.WriteFile(tmp, buf.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("could not write block index: %v", err)
+	}
+	return os.Rename(tmp, blockIndexPath(path))
+}
@@ -15,27 +15,67 @@ const (
 )
 
 func (gs *GameState) HandleMove(move ArmyMove) MoveOutcome {
-	defer fmt.Println("------------------------")
+	event := MoveDetected{Move: move}
+	defer func() { gs.present(event) }()
 	player := gs.GetPlayerSnap()
 
-	fmt.Println()
-	fmt.Println("==== Move Detected ====")
-	fmt.Printf("%s is moving %v unit(s) to %s\n", move.Player.Username, len(move.Units), move.ToLocation)
-	for _, unit := range move.Units {
-		fmt.Printf("* %v\n", unit.Rank)
+	if player.Username == move.Username {
+		event.Outcome = MoveOutcomeSamePlayer
+		return event.Outcome
+	}
+	gs.recordSightings(move.Username, move.Units)
+	gs.recordSightings(move.Username, move.Stationed)
+
+	event.Location = getOverlappingLocation(player, move.mover())
+	if event.Location != "" {
+		pact, ok := gs.GetPact(move.Username)
+		event.Pact = pact
+		if ok && pact == PactAlliance {
+			event.Outcome = MoveOutComeSafe
+			return event.Outcome
+		}
+		// Moving in on a nonaggression partner is aggression, and ends
+		// the pact.
+		if ok {
+			gs.endPact(move.Username)
+		}
+		event.Outcome = MoveOutcomeMakeWar
+		return event.Outcome
 	}
+	event.Outcome = MoveOutComeSafe
+	return event.Outcome
+}
 
-	if player.Username == move.Player.Username {
-		return MoveOutcomeSamePlayer
+// DeclareWar builds the recognition of war this player publishes after a
+// move returned MoveOutcomeMakeWar. Only the units in the contested
+// location are revealed to the other side.
+func (gs *GameState) DeclareWar(move ArmyMove) RecognitionOfWar {
+	attacker := gs.GetPlayerSnap()
+	for id, unit := range attacker.Units {
+		if unit.Location != move.ToLocation {
+			delete(attacker.Units, id)
+		}
+	}
+	return RecognitionOfWar{
+		Attacker: attacker,
+		Defender: move.mover(),
 	}
+}
 
-	overlappingLocation := getOverlappingLocation(player, move.Player)
-	if overlappingLocation != "" {
-		fmt.Printf("You have units in %s! You are at war with %s!\n", overlappingLocation, move.Player.Username)
-		return MoveOutcomeMakeWar
+// mover is the mover's whole presence at the destination: the units that
+// moved there and the ones that were already there.
+func (move ArmyMove) mover() Player {
+	units := map[int]Unit{}
+	for _, unit := range move.Stationed {
+		units[unit.ID] = unit
+	}
+	for _, unit := range move.Units {
+		units[unit.ID] = unit
+	}
+	return Player{
+		Username: move.Username,
+		Units:    units,
 	}
-	fmt.Printf("You are safe from %s's units.\n", move.Player.Username)
-	return MoveOutComeSafe
 }
 
 func getOverlappingLocation(p1 Player, p2 Player) Location {
@@ -50,7 +90,22 @@ func getOverlappingLocation(p1 Player, p2 Player) Location {
 }
 
 func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
-	if gs.isPaused() {
+	mv, err := gs.PlanMove(words)
+	if err != nil {
+		return ArmyMove{}, err
+	}
+	gs.ApplyMove(mv)
+	return mv, nil
+}
+
+// PlanMove checks a move command and returns the move it asks for without
+// making it, so that the move can be published before the player's units
+// are moved by ApplyMove.
+func (gs *GameState) PlanMove(words []string) (ArmyMove, error) {
+	if gs.IsOver() {
+		return ArmyMove{}, errors.New("the game is over, you can not move units")
+	}
+	if gs.IsPaused() {
 		return ArmyMove{}, errors.New("the game is paused, you can not move units")
 	}
 	if len(words) < 3 {
@@ -72,21 +127,43 @@ func (gs *GameState) CommandMove(words []string) (ArmyMove, error) {
 	}
 
 	newUnits := []Unit{}
+	moving := map[int]bool{}
 	for _, unitID := range unitIDs {
 		unit, ok := gs.GetUnit(unitID)
 		if !ok {
 			return ArmyMove{}, fmt.Errorf("error: unit with ID %v not found", unitID)
 		}
 		unit.Location = newLocation
-		gs.UpdateUnit(unit)
 		newUnits = append(newUnits, unit)
+		moving[unitID] = true
+	}
+	if partner, ok := gs.keptOutBy(newLocation); ok {
+		return ArmyMove{}, fmt.Errorf("error: your nonaggression pact with %s keeps you out of %s", partner, newLocation)
+	}
+	stationed := []Unit{}
+	for _, unit := range gs.GetPlayerSnap().Units {
+		if unit.Location == newLocation && !moving[unit.ID] {
+			stationed = append(stationed, unit)
+		}
 	}
 
-	mv := ArmyMove{
+	return ArmyMove{
 		ToLocation: newLocation,
 		Units:      newUnits,
-		Player:     gs.GetPlayerSnap(),
+		Stationed:  sortedUnits(stationed),
+		Username:   gs.GetUsername(),
+	}, nil
+}
+
+// ApplyMove moves the player's units as a move from PlanMove says.
+func (gs *GameState) ApplyMove(mv ArmyMove) {
+	gs.mu.Lock()
+	for _, unit := range mv.Units {
+		// A unit lost in a war after the move was planned stays lost.
+		if _, ok := gs.Player.Units[unit.ID]; ok {
+			gs.Player.Units[unit.ID] = unit
+		}
 	}
-	fmt.Printf("Moved %v units to %s\n", len(mv.Units), mv.ToLocation)
-	return mv, nil
+	gs.mu.Unlock()
+	gs.present(Moved{Move: mv})
 }
@@ -1,19 +1,14 @@
 package gamelogic
 
 import (
-	"fmt"
-
 	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
 )
 
 func (gs *GameState) HandlePause(ps routing.PlayingState) {
-	defer fmt.Println("------------------------")
-	fmt.Println()
 	if ps.IsPaused {
-		fmt.Println("==== Pause Detected ====")
 		gs.pauseGame()
 	} else {
-		fmt.Println("==== Resume Detected ====")
 		gs.resumeGame()
 	}
+	gs.present(Paused{Paused: ps.IsPaused})
 }
@@ -0,0 +1,301 @@
+package gamelogic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Presenter shows game events to a player, or to whatever is playing on
+// their behalf.
+type Presenter interface {
+	Present(e Event)
+}
+
+// PresenterFunc lets an ordinary function be used as a Presenter.
+type PresenterFunc func(e Event)
+
+func (f PresenterFunc) Present(e Event) {
+	f(e)
+}
+
+// Discard is a Presenter that ignores every event.
+var Discard Presenter = PresenterFunc(func(Event) {})
+
+// NewPresenter returns the presenter with the given name: text for the
+// human readable output, jsonl for one JSON object per line, or none.
+// The player is included in every JSON line so that several players can
+// share an output.
+func NewPresenter(name string, w io.Writer, player string) (Presenter, error) {
+	switch name {
+	case "", "text":
+		return NewTextPresenter(w), nil
+	case "jsonl":
+		return NewJSONLinesPresenter(w, player), nil
+	case "none":
+		return Discard, nil
+	}
+	return nil, fmt.Errorf("error: %s is not a valid output format", name)
+}
+
+// TextPresenter writes events the way the Peril terminal client always has.
+type TextPresenter struct {
+	w  io.Writer
+	mu *sync.Mutex
+}
+
+func NewTextPresenter(w io.Writer) *TextPresenter {
+	return &TextPresenter{
+		w:  w,
+		mu: &sync.Mutex{},
+	}
+}
+
+// Present writes each event in one go so that events handled at the same
+// time don't interleave.
+func (p *TextPresenter) Present(e Event) {
+	buf := &bytes.Buffer{}
+	writeText(buf, e)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.w.Write(buf.Bytes())
+}
+
+const rule = "------------------------"
+
+func writeText(w io.Writer, e Event) {
+	switch e := e.(type) {
+	case Paused:
+		fmt.Fprintln(w)
+		if e.Paused {
+			fmt.Fprintln(w, "==== Pause Detected ====")
+		} else {
+			fmt.Fprintln(w, "==== Resume Detected ====")
+		}
+		fmt.Fprintln(w, rule)
+	case MoveDetected:
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "==== Move Detected ====")
+		fmt.Fprintf(w, "%s is moving %v unit(s) to %s\n", e.Move.Username, len(e.Move.Units), e.Move.ToLocation)
+		for _, unit := range e.Move.Units {
+			fmt.Fprintf(w, "* %v\n", unit.Rank)
+		}
+		switch {
+		case e.Outcome == MoveOutcomeSamePlayer:
+		case e.Outcome == MoveOutcomeMakeWar && e.Pact != "":
+			fmt.Fprintf(w, "%s broke your %s by moving into %s! You are at war with %s!\n", e.Move.Username, e.Pact, e.Location, e.Move.Username)
+		case e.Outcome == MoveOutcomeMakeWar:
+			fmt.Fprintf(w, "You have units in %s! You are at war with %s!\n", e.Location, e.Move.Username)
+		case e.Pact != "":
+			fmt.Fprintf(w, "You have units in %s, but you have a %s with %s.\n", e.Location, e.Pact, e.Move.Username)
+		default:
+			fmt.Fprintf(w, "You are safe from %s's units.\n", e.Move.Username)
+		}
+		fmt.Fprintln(w, rule)
+	case Moved:
+		fmt.Fprintf(w, "Moved %v units to %s\n", len(e.Move.Units), e.Move.ToLocation)
+	case Spawned:
+		fmt.Fprintf(w, "Spawned a(n) %s in %s with id %v\n", e.Unit.Rank, e.Unit.Location, e.Unit.ID)
+	case WarFought:
+		writeWarText(w, e)
+	case WarResultReceived:
+		wr := e.Result
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "==== War Result ====")
+		if wr.Draw {
+			fmt.Fprintf(w, "Your war with %s in %s ended in a draw!\n", wr.Attacker, wr.Location)
+		} else if wr.Winner == wr.Defender {
+			fmt.Fprintf(w, "You have defended %s against %s!\n", wr.Location, wr.Attacker)
+		} else {
+			fmt.Fprintf(w, "You have lost %s to %s!\n", wr.Location, wr.Attacker)
+		}
+		writeCasualties(w, wr.Location, wr.DefenderCasualties)
+		fmt.Fprintln(w, rule)
+	case DiplomacySent:
+		d := e.Diplomacy
+		switch d.Action {
+		case DiplomacyPropose:
+			fmt.Fprintf(w, "Proposed a %s to %s\n", d.Pact, d.To)
+		case DiplomacyAccept:
+			fmt.Fprintf(w, "You now have a %s with %s\n", d.Pact, d.To)
+		case DiplomacyBreak:
+			fmt.Fprintf(w, "Broke your %s with %s\n", d.Pact, d.To)
+		}
+	case DiplomacyReceived:
+		d := e.Diplomacy
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "==== Diplomacy ====")
+		switch d.Action {
+		case DiplomacyPropose:
+			if e.Ignored {
+				fmt.Fprintf(w, "%s proposed a %s, but you already have a %s.\n", d.From, d.Pact, e.Existing)
+			} else {
+				fmt.Fprintf(w, "%s proposes a %s. Type \"accept %s\" to agree.\n", d.From, d.Pact, d.From)
+			}
+		case DiplomacyAccept:
+			if e.Ignored {
+				fmt.Fprintf(w, "%s accepted a %s you never proposed.\n", d.From, d.Pact)
+			} else {
+				fmt.Fprintf(w, "%s accepted your %s!\n", d.From, d.Pact)
+			}
+		case DiplomacyBreak:
+			fmt.Fprintf(w, "%s broke your %s!\n", d.From, d.Pact)
+		}
+		fmt.Fprintln(w, rule)
+	case ChatReceived:
+		msg := e.Message
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "[%s] %s: %s\n", ChatLabel(msg), msg.From, msg.Text)
+	case GameEnded:
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "==== Game Over ====")
+		if e.Over.Winner == "" {
+			fmt.Fprintf(w, "Nobody won: %s.\n", e.Over.Reason)
+		} else if e.Won {
+			fmt.Fprintf(w, "You won: %s!\n", e.Over.Reason)
+		} else {
+			fmt.Fprintf(w, "%s won: %s.\n", e.Over.Winner, e.Over.Reason)
+		}
+		fmt.Fprintln(w, "Final standings:")
+		for _, line := range FormatStandings(e.Over.Standings) {
+			fmt.Fprintln(w, line)
+		}
+		fmt.Fprintln(w, rule)
+	case Kicked:
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "==== Kicked ====")
+		if e.Kick.Reason == "" {
+			fmt.Fprintln(w, "The server removed you from the game.")
+		} else {
+			fmt.Fprintf(w, "The server removed you from the game: %s.\n", e.Kick.Reason)
+		}
+		fmt.Fprintln(w, rule)
+	case Status:
+		writeStatusText(w, e)
+	}
+}
+
+func writeWarText(w io.Writer, e WarFought) {
+	defer fmt.Fprintln(w, rule)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "==== War Declared ====")
+	fmt.Fprintf(w, "%s has declared war on %s!\n", e.Attacker, e.Defender)
+	switch e.Outcome {
+	case WarOutcomeNotInvolved:
+		if e.Player == e.Defender {
+			fmt.Fprintf(w, "%s, you published the war.\n", e.Player)
+		} else {
+			fmt.Fprintf(w, "%s, you are not involved in this war.\n", e.Player)
+		}
+		return
+	case WarOutcomeNoUnits:
+		fmt.Fprintf(w, "Error! No units are in the same location. No war will be fought.\n")
+		return
+	case WarOutcomePact:
+		fmt.Fprintf(w, "You have since made a %s with %s. No war will be fought.\n", e.Pact, e.Defender)
+		return
+	}
+
+	fmt.Fprintf(w, "%s's units:\n", e.Attacker)
+	for _, unit := range e.AttackerUnits {
+		fmt.Fprintf(w, "  * %v\n", unit.Rank)
+	}
+	fmt.Fprintf(w, "%s's units:\n", e.Defender)
+	for _, unit := range e.DefenderUnits {
+		fmt.Fprintf(w, "  * %v\n", unit.Rank)
+	}
+	fmt.Fprintf(w, "Attacker has a power level of %v\n", e.Result.AttackerPower)
+	fmt.Fprintf(w, "Defender has a power level of %v\n", e.Result.DefenderPower)
+	if e.Outcome == WarOutcomeDraw {
+		fmt.Fprintln(w, "The war ended in a draw!")
+	} else {
+		fmt.Fprintf(w, "%s has won the war!\n", e.Result.Winner)
+	}
+	if e.Outcome == WarOutcomeOpponentWon {
+		fmt.Fprintln(w, "You have lost the war!")
+	}
+	writeCasualties(w, e.Result.Location, e.Casualties)
+}
+
+func writeCasualties(w io.Writer, loc Location, ids []int) {
+	if len(ids) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%d of your units in %s have been killed.\n", len(ids), loc)
+}
+
+func writeStatusText(w io.Writer, s Status) {
+	if s.Over {
+		fmt.Fprintln(w, "The game is over.")
+		return
+	}
+	if s.Paused {
+		fmt.Fprintln(w, "The game is paused.")
+		return
+	}
+	fmt.Fprintln(w, "The game is not paused.")
+
+	p := s.Player
+	fmt.Fprintf(w, "You are %s, and you have %d units.\n", p.Username, len(p.Units))
+	units := []Unit{}
+	for _, unit := range p.Units {
+		units = append(units, unit)
+	}
+	for _, unit := range sortedUnits(units) {
+		fmt.Fprintf(w, "* %v: %v, %v\n", unit.ID, unit.Location, unit.Rank)
+	}
+	if len(s.Sightings) > 0 {
+		fmt.Fprintln(w, "Enemy units, last known positions:")
+	}
+	for _, sighting := range s.Sightings {
+		fmt.Fprintf(w, "* %s %v: %v, %v (seen %s)\n", sighting.Username, sighting.Unit.ID, sighting.Unit.Location, sighting.Unit.Rank, formatStaleness(s.Now.Sub(sighting.SeenAt)))
+	}
+	for _, rel := range s.Relations {
+		if rel.Active {
+			fmt.Fprintf(w, "You have a %s with %s.\n", rel.Pact, rel.Username)
+		} else if rel.ProposedBy == p.Username {
+			fmt.Fprintf(w, "You proposed a %s to %s.\n", rel.Pact, rel.Username)
+		} else {
+			fmt.Fprintf(w, "%s proposed a %s to you.\n", rel.Username, rel.Pact)
+		}
+	}
+}
+
+// JSONLinesPresenter writes every event as one JSON object per line, for
+// programs that play or watch the game.
+type JSONLinesPresenter struct {
+	w      io.Writer
+	player string
+	mu     *sync.Mutex
+}
+
+func NewJSONLinesPresenter(w io.Writer, player string) *JSONLinesPresenter {
+	return &JSONLinesPresenter{
+		w:      w,
+		player: player,
+		mu:     &sync.Mutex{},
+	}
+}
+
+type jsonLine struct {
+	Player string `json:"player,omitempty"`
+	Type   string `json:"type"`
+	Event  Event  `json:"event"`
+}
+
+func (p *JSONLinesPresenter) Present(e Event) {
+	data, err := json.Marshal(jsonLine{
+		Player: p.player,
+		Type:   e.Kind(),
+		Event:  e,
+	})
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.w.Write(data)
+}
@@ -5,30 +5,53 @@ import (
 	"fmt"
 )
 
-func (gs *GameState) CommandSpawn(words []string) error {
+func (gs *GameState) CommandSpawn(words []string) (ArmySpawn, error) {
+	spawn, err := gs.PlanSpawn(words)
+	if err != nil {
+		return ArmySpawn{}, err
+	}
+	gs.ApplySpawn(spawn)
+	return spawn, nil
+}
+
+// PlanSpawn checks a spawn command and returns the spawn it asks for without
+// making it, so that the spawn can be published before the unit is added by
+// ApplySpawn. The unit's ID is taken now, so that spawns planned at the same
+// time never share one.
+func (gs *GameState) PlanSpawn(words []string) (ArmySpawn, error) {
+	if gs.IsOver() {
+		return ArmySpawn{}, errors.New("the game is over, you can not spawn units")
+	}
 	if len(words) < 3 {
-		return errors.New("usage: spawn <location> <rank>")
+		return ArmySpawn{}, errors.New("usage: spawn <location> <rank>")
 	}
 
 	locationName := words[1]
 	locations := getAllLocations()
 	if _, ok := locations[Location(locationName)]; !ok {
-		return fmt.Errorf("error: %s is not a valid location", locationName)
+		return ArmySpawn{}, fmt.Errorf("error: %s is not a valid location", locationName)
 	}
 
 	rank := words[2]
 	units := getAllRanks()
 	if _, ok := units[UnitRank(rank)]; !ok {
-		return fmt.Errorf("error: %s is not a valid unit", rank)
+		return ArmySpawn{}, fmt.Errorf("error: %s is not a valid unit", rank)
 	}
 
-	id := len(gs.getUnitsSnap()) + 1
-	gs.addUnit(Unit{
-		ID:       id,
-		Rank:     UnitRank(rank),
-		Location: Location(locationName),
-	})
+	return ArmySpawn{
+		Username: gs.GetUsername(),
+		Unit: Unit{
+			ID:       gs.nextUnitID(),
+			Rank:     UnitRank(rank),
+			Location: Location(locationName),
+		},
+	}, nil
+}
 
-	fmt.Printf("Spawned a(n) %s in %s with id %v\n", rank, locationName, id)
-	return nil
+// ApplySpawn adds the unit from a spawn planned by PlanSpawn.
+func (gs *GameState) ApplySpawn(spawn ArmySpawn) {
+	gs.mu.Lock()
+	gs.Player.Units[spawn.Unit.ID] = spawn.Unit
+	gs.mu.Unlock()
+	gs.present(Spawned{Unit: spawn.Unit})
 }
@@ -0,0 +1,219 @@
+package gamelogic
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// locationScore is the number of points a player earns for every location
+// they control, on top of the power level of their surviving units.
+const locationScore = 10
+
+// TerritoryTracker keeps the server's view of the world: which units every
+// player has where, and who owns each location.
+//
+// A location is owned by the last player to hold it uncontested. Moving into
+// a location held by someone else contests it, and the owner only changes
+// once a war result (or the enemy moving out) leaves a single occupant.
+type TerritoryTracker struct {
+	units  map[string]map[int]Unit
+	owners map[Location]string
+	mu     *sync.RWMutex
+}
+
+func NewTerritoryTracker() *TerritoryTracker {
+	return &TerritoryTracker{
+		units:  map[string]map[int]Unit{},
+		owners: map[Location]string{},
+		mu:     &sync.RWMutex{},
+	}
+}
+
+// ApplyMove updates the position of the units carried by a move.
+func (t *TerritoryTracker) ApplyMove(move ArmyMove) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, unit := range move.Units {
+		t.addUnit(move.Username, unit)
+	}
+	t.updateOwners()
+}
+
+func (t *TerritoryTracker) ApplySpawn(spawn ArmySpawn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.addUnit(spawn.Username, spawn.Unit)
+	t.updateOwners()
+}
+
+// ApplyWarResult removes the units that died in a war and hands the location
+// to the winner.
+func (t *TerritoryTracker) ApplyWarResult(wr WarResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeUnits(wr.Attacker, wr.AttackerCasualties)
+	t.removeUnits(wr.Defender, wr.DefenderCasualties)
+	if !wr.Draw {
+		t.owners[wr.Location] = wr.Winner
+	}
+	t.updateOwners()
+}
+
+// RemovePlayer forgets a player and all of their units, giving up the
+// locations they owned. It reports whether the player was known.
+func (t *TerritoryTracker) RemovePlayer(username string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.units[username]; !ok {
+		return false
+	}
+	delete(t.units, username)
+	for loc, owner := range t.owners {
+		if owner == username {
+			delete(t.owners, loc)
+		}
+	}
+	t.updateOwners()
+	return true
+}
+
+// Units returns a player's units ordered by ID, and whether the player is
+// known at all.
+func (t *TerritoryTracker) Units(username string) ([]Unit, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	units, ok := t.units[username]
+	if !ok {
+		return nil, false
+	}
+	unitList := []Unit{}
+	for _, u := range units {
+		unitList = append(unitList, u)
+	}
+	return sortedUnits(unitList), true
+}
+
+// Owners returns the current owner of every controlled location.
+func (t *TerritoryTracker) Owners() map[Location]string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	owners := map[Location]string{}
+	for k, v := range t.owners {
+		owners[k] = v
+	}
+	return owners
+}
+
+// Standings ranks every known player by score, highest first.
+func (t *TerritoryTracker) Standings() []routing.Standing {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	controlled := map[string]int{}
+	for _, owner := range t.owners {
+		controlled[owner]++
+	}
+	standings := []routing.Standing{}
+	for username, units := range t.units {
+		unitList := []Unit{}
+		for _, u := range units {
+			unitList = append(unitList, u)
+		}
+		power := UnitsToPowerLevel(unitList)
+		standings = append(standings, routing.Standing{
+			Username:   username,
+			Score:      power + controlled[username]*locationScore,
+			Power:      power,
+			Units:      len(units),
+			Locations:  controlled[username],
+			Eliminated: len(units) == 0,
+		})
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		if standings[i].Score != standings[j].Score {
+			return standings[i].Score > standings[j].Score
+		}
+		return standings[i].Username < standings[j].Username
+	})
+	return standings
+}
+
+// Observers returns every player other than except whose units can see loc.
+func (t *TerritoryTracker) Observers(loc Location, except string) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	observers := []string{}
+	for username, units := range t.units {
+		if username == except {
+			continue
+		}
+		if _, ok := visibleLocations(units)[loc]; ok {
+			observers = append(observers, username)
+		}
+	}
+	sort.Strings(observers)
+	return observers
+}
+
+// VisibleTo reports the enemy units a player's units can currently see.
+func (t *TerritoryTracker) VisibleTo(username string, now time.Time) SightingReport {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	visible := visibleLocations(t.units[username])
+	report := SightingReport{Sightings: []Sighting{}}
+	for other, units := range t.units {
+		if other == username {
+			continue
+		}
+		for _, unit := range units {
+			if _, ok := visible[unit.Location]; ok {
+				report.Sightings = append(report.Sightings, Sighting{
+					Username: other,
+					Unit:     unit,
+					SeenAt:   now,
+				})
+			}
+		}
+	}
+	return report
+}
+
+func (t *TerritoryTracker) addUnit(username string, unit Unit) {
+	if t.units[username] == nil {
+		t.units[username] = map[int]Unit{}
+	}
+	t.units[username][unit.ID] = unit
+}
+
+func (t *TerritoryTracker) removeUnits(username string, ids []int) {
+	for _, id := range ids {
+		delete(t.units[username], id)
+	}
+}
+
+func (t *TerritoryTracker) updateOwners() {
+	occupants := map[Location]map[string]struct{}{}
+	for username, units := range t.units {
+		for _, u := range units {
+			if occupants[u.Location] == nil {
+				occupants[u.Location] = map[string]struct{}{}
+			}
+			occupants[u.Location][username] = struct{}{}
+		}
+	}
+	for loc, players := range occupants {
+		if len(players) != 1 {
+			continue
+		}
+		for username := range players {
+			t.owners[loc] = username
+		}
+	}
+	for loc, owner := range t.owners {
+		if len(t.units[owner]) == 0 {
+			delete(t.owners, loc)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package gamelogic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// VictoryCondition decides whether the game is over given the current
+// standings, which are sorted by score with the leader first.
+type VictoryCondition interface {
+	Check(standings []routing.Standing, now time.Time) (winner string, reason string, over bool)
+}
+
+// ControlLocations is won by the first player to control N locations.
+type ControlLocations struct {
+	N int
+}
+
+func (c ControlLocations) Check(standings []routing.Standing, now time.Time) (string, string, bool) {
+	for _, s := range standings {
+		if s.Locations >= c.N {
+			return s.Username, fmt.Sprintf("%s controls %d locations", s.Username, s.Locations), true
+		}
+	}
+	return "", "", false
+}
+
+// EliminateOpponents is won by the last player with units left standing.
+type EliminateOpponents struct{}
+
+func (EliminateOpponents) Check(standings []routing.Standing, now time.Time) (string, string, bool) {
+	if len(standings) < 2 {
+		return "", "", false
+	}
+	alive := []string{}
+	for _, s := range standings {
+		if !s.Eliminated {
+			alive = append(alive, s.Username)
+		}
+	}
+	if len(alive) != 1 {
+		return "", "", false
+	}
+	return alive[0], fmt.Sprintf("%s eliminated all opponents", alive[0]), true
+}
+
+// TimeLimit ends the game at Deadline and is won by the highest score.
+type TimeLimit struct {
+	Deadline time.Time
+}
+
+func (c TimeLimit) Check(standings []routing.Standing, now time.Time) (string, string, bool) {
+	if now.Before(c.Deadline) {
+		return "", "", false
+	}
+	if len(standings) == 0 {
+		return "", "time ran out with no players", true
+	}
+	if len(standings) > 1 && standings[0].Score == standings[1].Score {
+		return "", "time ran out with a tie for first place", true
+	}
+	return standings[0].Username, fmt.Sprintf("time ran out and %s has the highest score", standings[0].Username), true
+}
+
+// ParseVictoryConditions parses a comma separated list of conditions such as
+// "control:4,eliminate,time:30m". The spec "none" disables victory checks.
+func ParseVictoryConditions(spec string, start time.Time) ([]VictoryCondition, error) {
+	conditions := []VictoryCondition{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" || part == "none" {
+			continue
+		}
+		name, arg, _ := strings.Cut(part, ":")
+		switch name {
+		case "control":
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("error: %s is not a valid number of locations", arg)
+			}
+			if n > len(getAllLocations()) {
+				return nil, fmt.Errorf("error: there are only %d locations", len(getAllLocations()))
+			}
+			conditions = append(conditions, ControlLocations{N: n})
+		case "eliminate":
+			conditions = append(conditions, EliminateOpponents{})
+		case "time":
+			d, err := time.ParseDuration(arg)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("error: %s is not a valid time limit", arg)
+			}
+			conditions = append(conditions, TimeLimit{Deadline: start.Add(d)})
+		default:
+			return nil, fmt.Errorf("error: %s is not a valid victory condition", name)
+		}
+	}
+	return conditions, nil
+}
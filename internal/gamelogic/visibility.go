@@ -0,0 +1,100 @@
+package gamelogic
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// getAdjacentLocations describes which locations border each other. Units
+// can see their own location and every location adjacent to it.
+func getAdjacentLocations() map[Location][]Location {
+	return map[Location][]Location{
+		"americas":   {"europe", "africa", "asia", "antarctica"},
+		"europe":     {"americas", "africa", "asia"},
+		"africa":     {"americas", "europe", "asia", "antarctica"},
+		"asia":       {"americas", "europe", "africa", "australia"},
+		"australia":  {"asia", "antarctica"},
+		"antarctica": {"americas", "africa", "australia"},
+	}
+}
+
+// visibleLocations returns every location the given units can see.
+func visibleLocations(units map[int]Unit) map[Location]struct{} {
+	adjacent := getAdjacentLocations()
+	visible := map[Location]struct{}{}
+	for _, unit := range units {
+		visible[unit.Location] = struct{}{}
+		for _, loc := range adjacent[unit.Location] {
+			visible[loc] = struct{}{}
+		}
+	}
+	return visible
+}
+
+func (gs *GameState) HandleSightings(report SightingReport) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	for _, s := range report.Sightings {
+		if s.Username == gs.Player.Username {
+			continue
+		}
+		if gs.sightings[s.Username] == nil {
+			gs.sightings[s.Username] = map[int]Sighting{}
+		}
+		gs.sightings[s.Username][s.Unit.ID] = s
+	}
+}
+
+func (gs *GameState) recordSightings(username string, units []Unit) {
+	now := gs.Now()
+	sightings := []Sighting{}
+	for _, unit := range units {
+		sightings = append(sightings, Sighting{
+			Username: username,
+			Unit:     unit,
+			SeenAt:   now,
+		})
+	}
+	gs.HandleSightings(SightingReport{Sightings: sightings})
+}
+
+// forgetSightings drops the last known positions of enemy units that are
+// known to have died.
+func (gs *GameState) forgetSightings(username string, ids []int) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	for _, id := range ids {
+		delete(gs.sightings[username], id)
+	}
+}
+
+// GetSightingsSnap returns the last known position of every enemy unit,
+// most recently seen first.
+func (gs *GameState) GetSightingsSnap() []Sighting {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+	sightings := []Sighting{}
+	for _, units := range gs.sightings {
+		for _, s := range units {
+			sightings = append(sightings, s)
+		}
+	}
+	sort.Slice(sightings, func(i, j int) bool {
+		if !sightings[i].SeenAt.Equal(sightings[j].SeenAt) {
+			return sightings[i].SeenAt.After(sightings[j].SeenAt)
+		}
+		if sightings[i].Username != sightings[j].Username {
+			return sightings[i].Username < sightings[j].Username
+		}
+		return sightings[i].Unit.ID < sightings[j].Unit.ID
+	})
+	return sightings
+}
+
+func formatStaleness(d time.Duration) string {
+	if d < time.Second {
+		return "just now"
+	}
+	return fmt.Sprintf("%v ago", d.Truncate(time.Second))
+}
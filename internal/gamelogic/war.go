@@ -1,9 +1,5 @@
 package gamelogic
 
-import (
-	"fmt"
-)
-
 type WarOutcome int
 
 const (
@@ -12,94 +8,101 @@ const (
 	WarOutcomeYouWon
 	WarOutcomeOpponentWon
 	WarOutcomeDraw
+	WarOutcomePact
 )
 
-func (gs *GameState) HandleWar(rw RecognitionOfWar) (outcome WarOutcome, winner string, loser string) {
-	defer fmt.Println("------------------------")
-	fmt.Println()
-	fmt.Println("==== War Declared ====")
-	fmt.Printf("%s has declared war on %s!\n", rw.Attacker.Username, rw.Defender.Username)
-
+func (gs *GameState) HandleWar(rw RecognitionOfWar) (WarOutcome, WarResult) {
 	player := gs.GetPlayerSnap()
+	event := WarFought{
+		Player:   player.Username,
+		Attacker: rw.Attacker.Username,
+		Defender: rw.Defender.Username,
+	}
+	defer func() { gs.present(event) }()
 
 	if player.Username == rw.Defender.Username {
-		fmt.Printf("%s, you published the war.\n", player.Username)
-		return WarOutcomeNotInvolved, "", ""
+		event.Outcome = WarOutcomeNotInvolved
+		return event.Outcome, WarResult{}
 	}
 
 	if player.Username != rw.Attacker.Username {
-		fmt.Printf("%s, you are not involved in this war.\n", player.Username)
-		return WarOutcomeNotInvolved, "", ""
+		event.Outcome = WarOutcomeNotInvolved
+		return event.Outcome, WarResult{}
+	}
+
+	// The move that started the war was checked against the pacts in
+	// force then, but a pact made since calls the war off.
+	if pact, ok := gs.GetPact(rw.Defender.Username); ok {
+		event.Pact = pact
+		event.Outcome = WarOutcomePact
+		return event.Outcome, WarResult{}
 	}
 
 	overlappingLocation := getOverlappingLocation(rw.Attacker, rw.Defender)
 	if overlappingLocation == "" {
-		fmt.Printf("Error! No units are in the same location. No war will be fought.\n")
-		return WarOutcomeNoUnits, "", ""
+		event.Outcome = WarOutcomeNoUnits
+		return event.Outcome, WarResult{}
 	}
 
-	attackerUnits := []Unit{}
-	defenderUnits := []Unit{}
+	result := WarResult{
+		Attacker: rw.Attacker.Username,
+		Defender: rw.Defender.Username,
+		Location: overlappingLocation,
+	}
 	for _, unit := range rw.Attacker.Units {
 		if unit.Location == overlappingLocation {
-			attackerUnits = append(attackerUnits, unit)
+			event.AttackerUnits = append(event.AttackerUnits, unit)
 		}
 	}
 	for _, unit := range rw.Defender.Units {
 		if unit.Location == overlappingLocation {
-			defenderUnits = append(defenderUnits, unit)
+			event.DefenderUnits = append(event.DefenderUnits, unit)
 		}
 	}
+	event.AttackerUnits = sortedUnits(event.AttackerUnits)
+	event.DefenderUnits = sortedUnits(event.DefenderUnits)
 
-	fmt.Printf("%s's units:\n", rw.Attacker.Username)
-	for _, unit := range attackerUnits {
-		fmt.Printf("  * %v\n", unit.Rank)
-	}
-	fmt.Printf("%s's units:\n", rw.Defender.Username)
-	for _, unit := range defenderUnits {
-		fmt.Printf("  * %v\n", unit.Rank)
-	}
-	attackerPower := unitsToPowerLevel(attackerUnits)
-	defenderPower := unitsToPowerLevel(defenderUnits)
-	fmt.Printf("Attacker has a power level of %v\n", attackerPower)
-	fmt.Printf("Defender has a power level of %v\n", defenderPower)
-	if attackerPower > defenderPower {
-		fmt.Printf("%s has won the war!\n", rw.Attacker.Username)
-		if player.Username == rw.Defender.Username {
-			fmt.Println("You have lost the war!")
-			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-			return WarOutcomeOpponentWon, rw.Attacker.Username, rw.Defender.Username
-		}
-		return WarOutcomeYouWon, rw.Attacker.Username, rw.Defender.Username
-	} else if defenderPower > attackerPower {
-		fmt.Printf("%s has won the war!\n", rw.Defender.Username)
-		if player.Username == rw.Attacker.Username {
-			fmt.Println("You have lost the war!")
-			gs.removeUnitsInLocation(overlappingLocation)
-			fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-			return WarOutcomeOpponentWon, rw.Defender.Username, rw.Attacker.Username
-		}
-		return WarOutcomeYouWon, rw.Defender.Username, rw.Attacker.Username
+	seed := gs.nextSeed()
+	resolver := gs.getCombatResolver()
+	battle := resolver.Resolve(event.AttackerUnits, event.DefenderUnits, overlappingLocation, seed)
+	result.Seed = seed
+	result.Resolver = resolver.Name()
+	result.AttackerPower = battle.AttackerPower
+	result.DefenderPower = battle.DefenderPower
+	result.AttackerCasualties = battle.AttackerCasualties
+	result.DefenderCasualties = battle.DefenderCasualties
+	gs.forgetSightings(rw.Defender.Username, battle.DefenderCasualties)
+
+	// Only the attacker resolves a war, so the casualties applied here are
+	// always the attacker's.
+	gs.removeUnits(battle.AttackerCasualties)
+	event.Casualties = battle.AttackerCasualties
+	switch battle.Winner {
+	case SideAttacker:
+		result.Winner, result.Loser = rw.Attacker.Username, rw.Defender.Username
+		event.Outcome = WarOutcomeYouWon
+	case SideDefender:
+		result.Winner, result.Loser = rw.Defender.Username, rw.Attacker.Username
+		event.Outcome = WarOutcomeOpponentWon
+	default:
+		result.Winner, result.Loser = rw.Attacker.Username, rw.Defender.Username
+		result.Draw = true
+		event.Outcome = WarOutcomeDraw
 	}
-	fmt.Println("The war ended in a draw!")
-	fmt.Printf("Your units in %s have been killed.\n", overlappingLocation)
-	gs.removeUnitsInLocation(overlappingLocation)
-	return WarOutcomeDraw, rw.Attacker.Username, rw.Defender.Username
+	event.Result = result
+	return event.Outcome, result
 }
 
-func unitsToPowerLevel(units []Unit) int {
-	power := 0
-	for _, unit := range units {
-		if unit.Rank == RankArtillery {
-			power += 10
-		}
-		if unit.Rank == RankCavalry {
-			power += 5
-		}
-		if unit.Rank == RankInfantry {
-			power += 1
-		}
+// HandleWarResult applies the outcome of a war fought by someone else. Only
+// the attacker resolves a war, so this is how the defender learns which of
+// their units in the contested location were killed. A war ends any pact
+// between its sides.
+func (gs *GameState) HandleWarResult(wr WarResult) {
+	if gs.GetUsername() != wr.Defender {
+		return
 	}
-	return power
+	gs.endPact(wr.Attacker)
+	gs.forgetSightings(wr.Attacker, wr.AttackerCasualties)
+	gs.removeUnits(wr.DefenderCasualties)
+	gs.present(WarResultReceived{Result: wr})
 }
@@ -0,0 +1,196 @@
+package membus
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var ErrClosed = errors.New("membus: bus is closed")
+
+// Bus is an in-process stand-in for the RabbitMQ broker. It routes
+// publishings to queues with AMQP topic semantics ("*" matches one word,
+// "#" matches zero or more), which also covers the direct exchange since a
+// pattern without wildcards only matches itself.
+//
+// Bus satisfies pubsub.Publisher and pubsub.Source, and the deliveries it
+// hands out can be acked and nacked like the ones from a real channel.
+type Bus struct {
+	queues   map[string]*queue
+	bindings []binding
+	closed   bool
+	mu       *sync.RWMutex
+}
+
+type binding struct {
+	exchange string
+	pattern  string
+	queue    string
+}
+
+func New() *Bus {
+	return &Bus{
+		queues: map[string]*queue{},
+		mu:     &sync.RWMutex{},
+	}
+}
+
+// Bind routes messages published to exchange with a key matching pattern to
+// the named queue, declaring the queue if needed.
+func (b *Bus) Bind(queueName, exchange, pattern string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.declare(queueName)
+	b.bindings = append(b.bindings, binding{
+		exchange: exchange,
+		pattern:  pattern,
+		queue:    queueName,
+	})
+}
+
+// Consume returns the deliveries of a queue. Every call for the same queue
+// returns the same channel, so several consumers compete for messages just
+// like they do on a shared RabbitMQ queue.
+func (b *Bus) Consume(queueName string) <-chan amqp.Delivery {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.declare(queueName).out
+}
+
+// Deliveries binds and consumes a queue in one go. Queue types are ignored
+// since nothing outlives the bus anyway.
+func (b *Bus) Deliveries(exchange, queueName, key string, queueType pubsub.SimpleQueueType) (<-chan amqp.Delivery, error) {
+	b.Bind(queueName, exchange, key)
+	return b.Consume(queueName), nil
+}
+
+// Idle reports whether every queue is empty and every delivery has been
+// acknowledged, meaning nothing is in flight.
+func (b *Bus) Idle() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, q := range b.queues {
+		q.mu.Lock()
+		busy := len(q.ready) > 0 || len(q.unacked) > 0
+		q.mu.Unlock()
+		if busy {
+			return false
+		}
+	}
+	return true
+}
+
+// DeadLetters returns the messages that were nacked without requeue.
+func (b *Bus) DeadLetters(queueName string) []amqp.Delivery {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q := b.declare(queueName)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]amqp.Delivery{}, q.dead...)
+}
+
+// Pending returns how many messages of a queue are waiting to be delivered
+// or acknowledged.
+func (b *Bus) Pending(queueName string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q := b.declare(queueName)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.ready) + len(q.unacked)
+}
+
+func (b *Bus) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return ErrClosed
+	}
+	routed := map[string]struct{}{}
+	for _, bnd := range b.bindings {
+		if bnd.exchange != exchange || !matchTopic(bnd.pattern, key) {
+			continue
+		}
+		if _, ok := routed[bnd.queue]; ok {
+			continue
+		}
+		routed[bnd.queue] = struct{}{}
+		b.queues[bnd.queue].push(amqp.Delivery{
+			Headers:         msg.Headers,
+			ContentType:     msg.ContentType,
+			ContentEncoding: msg.ContentEncoding,
+			DeliveryMode:    msg.DeliveryMode,
+			Priority:        msg.Priority,
+			CorrelationId:   msg.CorrelationId,
+			ReplyTo:         msg.ReplyTo,
+			Expiration:      msg.Expiration,
+			MessageId:       msg.MessageId,
+			Timestamp:       msg.Timestamp,
+			Type:            msg.Type,
+			UserId:          msg.UserId,
+			AppId:           msg.AppId,
+			Exchange:        exchange,
+			RoutingKey:      key,
+			Body:            append([]byte{}, msg.Body...),
+		})
+	}
+	return nil
+}
+
+// Close stops every queue and closes the channels returned by Consume.
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	for _, q := range b.queues {
+		q.close()
+	}
+	return nil
+}
+
+func (b *Bus) declare(name string) *queue {
+	q, ok := b.queues[name]
+	if !ok {
+		q = newQueue(name)
+		b.queues[name] = q
+		if b.closed {
+			q.close()
+		} else {
+			go q.pump()
+		}
+	}
+	return q
+}
+
+func matchTopic(pattern, key string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(key, "."))
+}
+
+func matchWords(pattern, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(key); i++ {
+			if matchWords(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(key) > 0 && matchWords(pattern[1:], key[1:])
+	}
+	return len(key) > 0 && pattern[0] == key[0] && matchWords(pattern[1:], key[1:])
+}
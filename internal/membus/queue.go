@@ -0,0 +1,133 @@
+package membus
+
+import (
+	"errors"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var errUnknownTag = errors.New("membus: unknown delivery tag")
+
+// queue buffers deliveries without limit and hands them to consumers one
+// at a time. It is the Acknowledger of every delivery it hands out.
+type queue struct {
+	name    string
+	ready   []amqp.Delivery
+	unacked map[uint64]amqp.Delivery
+	dead    []amqp.Delivery
+	nextTag uint64
+	out     chan amqp.Delivery
+	done    chan struct{}
+	closed  bool
+	mu      *sync.Mutex
+	cond    *sync.Cond
+}
+
+func newQueue(name string) *queue {
+	mu := &sync.Mutex{}
+	return &queue{
+		name:    name,
+		unacked: map[uint64]amqp.Delivery{},
+		out:     make(chan amqp.Delivery),
+		done:    make(chan struct{}),
+		mu:      mu,
+		cond:    sync.NewCond(mu),
+	}
+}
+
+func (q *queue) push(d amqp.Delivery) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.ready = append(q.ready, d)
+	q.cond.Signal()
+}
+
+func (q *queue) pump() {
+	defer close(q.out)
+	for {
+		q.mu.Lock()
+		for len(q.ready) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		d := q.ready[0]
+		q.ready = q.ready[1:]
+		q.nextTag++
+		d.DeliveryTag = q.nextTag
+		d.Acknowledger = q
+		q.unacked[d.DeliveryTag] = d
+		q.mu.Unlock()
+
+		select {
+		case q.out <- d:
+		case <-q.done:
+			return
+		}
+	}
+}
+
+func (q *queue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	close(q.done)
+	q.cond.Broadcast()
+}
+
+func (q *queue) Ack(tag uint64, multiple bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.settle(tag, multiple, func(amqp.Delivery) {})
+}
+
+func (q *queue) Nack(tag uint64, multiple bool, requeue bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.settle(tag, multiple, func(d amqp.Delivery) {
+		// Unlike RabbitMQ, requeued messages go to the back of the
+		// queue so that a consumer that keeps requeueing can't starve
+		// the rest.
+		if requeue {
+			d.Redelivered = true
+			q.ready = append(q.ready, d)
+			q.cond.Signal()
+			return
+		}
+		q.dead = append(q.dead, d)
+	})
+}
+
+func (q *queue) Reject(tag uint64, requeue bool) error {
+	return q.Nack(tag, false, requeue)
+}
+
+// settle removes one delivery, or every delivery up to tag when multiple is
+// set, from the unacked set and hands each one to fn.
+func (q *queue) settle(tag uint64, multiple bool, fn func(amqp.Delivery)) error {
+	if !multiple {
+		d, ok := q.unacked[tag]
+		if !ok {
+			return errUnknownTag
+		}
+		delete(q.unacked, tag)
+		fn(d)
+		return nil
+	}
+	for t, d := range q.unacked {
+		if t <= tag {
+			delete(q.unacked, t)
+			fn(d)
+		}
+	}
+	return nil
+}
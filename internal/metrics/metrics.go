@@ -0,0 +1,22 @@
+// Package metrics serves the Prometheus metrics recorded throughout Peril:
+// message counts and handler latencies from pubsub, and game events from
+// the referee and client sessions.
+package metrics
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Serve serves /metrics on addr in the background. If the server stops,
+// such as when the address is taken, the error is logged.
+func Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.Handler())
+	go func() {
+		err := http.ListenAndServe(addr, mux)
+		slog.Error("could not serve metrics", "addr", addr, "err", err)
+	}()
+}
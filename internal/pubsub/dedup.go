@@ -0,0 +1,238 @@
+package pubsub
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DedupStore remembers the IDs of messages that have been handled, so that
+// a message delivered again, such as after its ack was lost, can be
+// skipped. It holds at most size IDs, each for ttl, forgetting the oldest
+// first. With a journal the IDs outlive a restart.
+type DedupStore struct {
+	size    int
+	ttl     time.Duration
+	expires map[string]time.Time
+	// order holds the IDs oldest first. As every ID is kept for the same
+	// time, that is also the order they expire in.
+	order   []string
+	journal *os.File
+	lines   int
+	path    string
+	now     func() time.Time
+	mu      *sync.Mutex
+}
+
+func NewDedupStore(size int, ttl time.Duration) *DedupStore {
+	return &DedupStore{
+		size:    size,
+		ttl:     ttl,
+		expires: map[string]time.Time{},
+		now:     time.Now,
+		mu:      &sync.Mutex{},
+	}
+}
+
+// OpenDedupStore is NewDedupStore with the IDs kept in a journal at path
+// as well, starting with the ones already there.
+func OpenDedupStore(path string, size int, ttl time.Duration) (*DedupStore, error) {
+	s := NewDedupStore(size, ttl)
+	s.path = path
+	f, err := os.Open(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("could not open dedup journal: %v", err)
+	}
+	if err == nil {
+		defer f.Close()
+		now := s.now()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			stamp, id, ok := strings.Cut(scanner.Text(), " ")
+			nanos, err := strconv.ParseInt(stamp, 10, 64)
+			if !ok || err != nil {
+				continue
+			}
+			expires := time.Unix(0, nanos)
+			if expires.After(now) {
+				s.remember(id, expires)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("could not read dedup journal: %v", err)
+		}
+	}
+	err = s.compact()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Seen reports whether id has been handled within the TTL.
+func (s *DedupStore) Seen(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.expires[id]
+	return ok && expires.After(s.now())
+}
+
+// Add records that id has been handled.
+func (s *DedupStore) Add(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires := s.now().Add(s.ttl)
+	s.remember(id, expires)
+	if s.journal == nil {
+		return nil
+	}
+	_, err := fmt.Fprintf(s.journal, "%d %s\n", expires.UnixNano(), id)
+	if err != nil {
+		return fmt.Errorf("could not write dedup journal: %v", err)
+	}
+	s.lines++
+	// The journal keeps every ID ever added, so it is rewritten with
+	// just the remembered ones once it is twice as long as it needs to
+	// be.
+	if s.lines > 2*s.size {
+		return s.compact()
+	}
+	return nil
+}
+
+func (s *DedupStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.journal == nil {
+		return nil
+	}
+	err := s.journal.Close()
+	s.journal = nil
+	return err
+}
+
+func (s *DedupStore) remember(id string, expires time.Time) {
+	if _, ok := s.expires[id]; !ok {
+		s.order = append(s.order, id)
+	}
+	s.expires[id] = expires
+	now := s.now()
+	for len(s.order) > 0 {
+		oldest := s.order[0]
+		if len(s.order) <= s.size && s.expires[oldest].After(now) {
+			break
+		}
+		delete(s.expires, oldest)
+		s.order = s.order[1:]
+	}
+}
+
+// compact replaces the journal with one holding only the remembered IDs.
+func (s *DedupStore) compact() error {
+	if s.journal != nil {
+		s.journal.Close()
+		s.journal = nil
+	}
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("could not write dedup journal: %v", err)
+	}
+	w := bufio.NewWriter(f)
+	for _, id := range s.order {
+		fmt.Fprintf(w, "%d %s\n", s.expires[id].UnixNano(), id)
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp, s.path)
+	}
+	if err != nil {
+		return fmt.Errorf("could not write dedup journal: %v", err)
+	}
+	s.journal, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open dedup journal: %v", err)
+	}
+	s.lines = len(s.order)
+	return nil
+}
+
+type dedupSource struct {
+	src   Source
+	store *DedupStore
+}
+
+// Deduplicate makes every subscription to src skip messages whose ID is in
+// store, acking them without handling them. A message's ID is added once
+// its handler acks it, so messages that were requeued or rejected are
+// handled again if they come back. Messages without an ID are always
+// handled.
+func Deduplicate(src Source, store *DedupStore) Source {
+	return dedupSource{src: src, store: store}
+}
+
+func (s dedupSource) Deliveries(exchange, queueName, key string, queueType SimpleQueueType) (<-chan amqp.Delivery, error) {
+	in, err := s.src.Deliveries(exchange, queueName, key, queueType)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan amqp.Delivery)
+	go func() {
+		defer close(out)
+		for delivery := range in {
+			if delivery.MessageId == "" {
+				out <- delivery
+				continue
+			}
+			if s.store.Seen(delivery.MessageId) {
+				duplicatesTotal.WithLabelValues(delivery.Exchange, keyLabel(delivery.RoutingKey)).Inc()
+				slog.Debug("skipping duplicate message", "queue", queueName, "routing_key", delivery.RoutingKey, "message_id", delivery.MessageId)
+				err := delivery.Ack(false)
+				if err != nil {
+					slog.Error("failed to ack duplicate message", "queue", queueName, "message_id", delivery.MessageId, "err", err)
+				}
+				continue
+			}
+			delivery.Acknowledger = dedupAcker{
+				Acknowledger: delivery.Acknowledger,
+				store:        s.store,
+				id:           delivery.MessageId,
+			}
+			out <- delivery
+		}
+	}()
+	return out, nil
+}
+
+// dedupAcker adds the ID of the delivery to the store when it is acked.
+type dedupAcker struct {
+	amqp.Acknowledger
+	store *DedupStore
+	id    string
+}
+
+func (a dedupAcker) Ack(tag uint64, multiple bool) error {
+	err := a.Acknowledger.Ack(tag, multiple)
+	if err != nil {
+		return err
+	}
+	err = a.store.Add(a.id)
+	if err != nil {
+		slog.Error("could not remember handled message", "message_id", a.id, "err", err)
+	}
+	return nil
+}
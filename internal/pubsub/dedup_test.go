@@ -0,0 +1,98 @@
+package pubsub
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestDedupStore(t *testing.T, path string, size int, ttl time.Duration) *DedupStore {
+	t.Helper()
+	s, err := OpenDedupStore(path, size, ttl)
+	if err != nil {
+		t.Fatalf("could not open dedup store: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func addIDs(t *testing.T, s *DedupStore, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		err := s.Add(id)
+		if err != nil {
+			t.Fatalf("could not add %s: %v", id, err)
+		}
+	}
+}
+
+func TestDedupStoreSurvivesARestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.journal")
+	s := openTestDedupStore(t, path, 100, time.Hour)
+	addIDs(t, s, "a", "b")
+	s.Close()
+
+	s = openTestDedupStore(t, path, 100, time.Hour)
+	for _, id := range []string{"a", "b"} {
+		if !s.Seen(id) {
+			t.Fatalf("expected %s to be remembered after a restart", id)
+		}
+	}
+	if s.Seen("c") {
+		t.Fatal("expected an ID that was never added not to be seen")
+	}
+}
+
+func TestDedupStoreForgetsExpiredIDsOnRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.journal")
+	s := openTestDedupStore(t, path, 100, time.Hour)
+	s.now = func() time.Time { return time.Now().Add(-2 * time.Hour) }
+	addIDs(t, s, "old")
+	s.now = time.Now
+	addIDs(t, s, "new")
+	s.Close()
+
+	s = openTestDedupStore(t, path, 100, time.Hour)
+	if s.Seen("old") {
+		t.Fatal("expected an ID past its TTL to be forgotten")
+	}
+	if !s.Seen("new") {
+		t.Fatal("expected an ID within its TTL to be remembered")
+	}
+}
+
+func TestDedupStoreCompactsItsJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup.journal")
+	s := openTestDedupStore(t, path, 3, time.Hour)
+	ids := make([]string, 20)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("id-%d", i)
+	}
+	addIDs(t, s, ids...)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read journal: %v", err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines > 2*3 {
+		t.Fatalf("expected the journal to be compacted to at most 6 lines, got %d", lines)
+	}
+	s.Close()
+
+	s = openTestDedupStore(t, path, 3, time.Hour)
+	for i, id := range ids {
+		if want := i >= len(ids)-3; s.Seen(id) != want {
+			t.Fatalf("expected only the newest 3 IDs to be remembered after a restart, got %s seen %v", id, !want)
+		}
+	}
+	// The journal is still written to after being compacted on opening.
+	addIDs(t, s, "late")
+	s.Close()
+	s = openTestDedupStore(t, path, 3, time.Hour)
+	if !s.Seen("late") {
+		t.Fatal("expected an ID added after a restart to be remembered after the next")
+	}
+}
@@ -0,0 +1,68 @@
+package pubsub
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Routing keys carry usernames, so metrics are labelled with the first
+// part of the key only, such as army_moves, to keep the number of series
+// bounded.
+var (
+	publishedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_messages_published_total",
+		Help: "Messages published, by exchange and routing key prefix.",
+	}, []string{"exchange", "key"})
+	publishFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_publish_failures_total",
+		Help: "Messages that could not be published.",
+	}, []string{"exchange", "key"})
+	consumedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_messages_consumed_total",
+		Help: "Messages delivered to a consumer.",
+	}, []string{"exchange", "key"})
+	ackedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_messages_acked_total",
+		Help: "Messages acknowledged after being handled.",
+	}, []string{"exchange", "key"})
+	nackedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_messages_nacked_total",
+		Help: "Messages rejected, with requeue true or false.",
+	}, []string{"exchange", "key", "requeue"})
+	duplicatesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_duplicates_skipped_total",
+		Help: "Messages acked without being handled because they had been handled before.",
+	}, []string{"exchange", "key"})
+	decodeFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_decode_failures_total",
+		Help: "Messages whose body could not be decoded.",
+	}, []string{"exchange", "key"})
+	handlerSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "peril_handler_duration_seconds",
+		Help:    "Time taken by message handlers.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+	}, []string{"exchange", "key"})
+	inFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "peril_handlers_in_flight",
+		Help: "Messages being handled right now.",
+	}, []string{"exchange", "key"})
+)
+
+func keyLabel(key string) string {
+	prefix, _, _ := strings.Cut(key, ".")
+	return prefix
+}
+
+// timeHandler runs a handler, counting it as in flight while it runs and
+// recording how long it took. Time spent waiting to settle a deferred
+// message afterwards is not counted.
+func timeHandler(exchange, key string, handle func()) {
+	gauge := inFlight.WithLabelValues(exchange, key)
+	gauge.Inc()
+	defer gauge.Dec()
+	timer := prometheus.NewTimer(handlerSeconds.WithLabelValues(exchange, key))
+	defer timer.ObserveDuration()
+	handle()
+}
@@ -0,0 +1,254 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrOutboxClosed is returned for messages posted to an outbox that has been
+// closed.
+var ErrOutboxClosed = errors.New("error: outbox is closed")
+
+// ErrUnconfirmed is returned when a message was sent but the broker never
+// said whether it took it, so it may or may not have been published.
+var ErrUnconfirmed = errors.New("error: broker did not confirm the message")
+
+// Outbox publishes messages one at a time in the order they were posted,
+// and makes the local state change that goes with each only once the
+// broker has confirmed it. A message the broker is known not to have is
+// given up on after a few attempts and its change is never made, so the
+// local state never shows something the rest of the game didn't see.
+//
+// A message whose confirm never came may have been seen already, so giving
+// up on it could leave the opposite mismatch. It is sent again under the
+// same ID, which consumers skip once they have seen it, for as long as it
+// takes a copy to be confirmed. Only closing the outbox ends that, and the
+// change is then not made: its owner is going away.
+//
+// The outbox is held in memory. Nothing posted survives the process, but
+// neither does the state the changes would have been made to.
+type Outbox struct {
+	pub       Publisher
+	attempts  int
+	backoff   time.Duration
+	timeout   time.Duration
+	entries   chan outboxEntry
+	quit      chan struct{}
+	closeOnce *sync.Once
+	stopped   chan struct{}
+}
+
+type outboxEntry struct {
+	ctx      context.Context
+	exchange string
+	key      string
+	msg      amqp.Publishing
+	apply    func()
+	done     chan error
+}
+
+// NewOutbox starts an outbox that publishes through pub. Publish through a
+// publisher from NewConfirmingPublisher, so that a message only counts as
+// published once the broker has it.
+func NewOutbox(pub Publisher) *Outbox {
+	o := &Outbox{
+		pub:       pub,
+		attempts:  5,
+		backoff:   200 * time.Millisecond,
+		timeout:   5 * time.Second,
+		entries:   make(chan outboxEntry, 64),
+		quit:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+		stopped:   make(chan struct{}),
+	}
+	go o.relay()
+	return o
+}
+
+// SetRetries changes how many times a message is tried before it is given
+// up on, and how long to wait before the first retry. The wait doubles
+// after every failed attempt, up to the confirm timeout.
+func (o *Outbox) SetRetries(attempts int, backoff time.Duration) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	o.attempts = attempts
+	o.backoff = backoff
+}
+
+// PostJSON publishes val through the outbox and calls apply once the broker
+// has confirmed it. It blocks until then, and returns the error of the last
+// attempt if the message could not be published, in which case apply is
+// never called.
+func PostJSON[T any](ctx context.Context, o *Outbox, exchange, key string, val T, apply func()) error {
+	bytes, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return o.post(ctx, exchange, key, amqp.Publishing{
+		ContentType: "application/json",
+		Body:        bytes,
+	}, apply)
+}
+
+func (o *Outbox) post(ctx context.Context, exchange, key string, msg amqp.Publishing, apply func()) error {
+	// The ID is fixed now, so that consumers skip the copies a retry may
+	// leave behind when a confirm is lost rather than the message.
+	msg.MessageId = newMessageID()
+	entry := outboxEntry{
+		ctx:      ctx,
+		exchange: exchange,
+		key:      key,
+		msg:      msg,
+		apply:    apply,
+		done:     make(chan error, 1),
+	}
+	select {
+	case <-o.quit:
+		return ErrOutboxClosed
+	default:
+	}
+	select {
+	case o.entries <- entry:
+	case <-o.quit:
+		return ErrOutboxClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-entry.done:
+		return err
+	case <-o.stopped:
+		// The relay may have finished the entry just before it stopped.
+		select {
+		case err := <-entry.done:
+			return err
+		default:
+			return ErrOutboxClosed
+		}
+	}
+}
+
+// Close publishes whatever has already been posted, then stops the relay.
+// Messages waiting on a confirm are given up on.
+func (o *Outbox) Close() {
+	o.closeOnce.Do(func() {
+		close(o.quit)
+	})
+	<-o.stopped
+}
+
+func (o *Outbox) relay() {
+	defer close(o.stopped)
+	for {
+		select {
+		case entry := <-o.entries:
+			o.handle(entry)
+		case <-o.quit:
+			for {
+				select {
+				case entry := <-o.entries:
+					o.handle(entry)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (o *Outbox) handle(entry outboxEntry) {
+	err := o.send(entry)
+	if err == nil && entry.apply != nil {
+		entry.apply()
+	}
+	if errors.Is(err, ErrUnconfirmed) {
+		slog.Error("gave up on a message that may have been published", "routing_key", entry.key, "message_id", entry.msg.MessageId, "err", err)
+	}
+	entry.done <- err
+}
+
+func (o *Outbox) send(entry outboxEntry) error {
+	logger := slog.Default().With("routing_key", entry.key, "message_id", entry.msg.MessageId)
+	wait := o.backoff
+	// inDoubt is set once an attempt may have reached the broker without
+	// being confirmed. From then on the message is tried until a copy is
+	// confirmed, however many attempts that takes.
+	inDoubt := false
+	var err error
+	for attempt := 1; attempt <= o.attempts || inDoubt; attempt++ {
+		if attempt > 1 {
+			// Closing only cuts short the attempts past the usual
+			// number, so that what was posted before still goes out.
+			var quit chan struct{}
+			if attempt > o.attempts {
+				quit = o.quit
+			}
+			select {
+			case <-time.After(wait):
+			case <-quit:
+				return fmt.Errorf("%w, gave up after %d attempts: %v", ErrUnconfirmed, attempt-1, err)
+			case <-entry.ctx.Done():
+				if inDoubt {
+					return fmt.Errorf("%w: %v", ErrUnconfirmed, entry.ctx.Err())
+				}
+				return entry.ctx.Err()
+			}
+			wait = min(wait*2, o.timeout)
+		}
+		ctx, cancel := context.WithTimeout(entry.ctx, o.timeout)
+		// publish fills in the trace headers, so each attempt gets a fresh
+		// copy of them.
+		msg := entry.msg
+		msg.Headers = amqp.Table{}
+		err = publish(ctx, o.pub, entry.exchange, entry.key, msg)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, ErrUnconfirmed) {
+			inDoubt = true
+		}
+		logger.Warn("failed to publish message from outbox", "attempt", attempt, "in_doubt", inDoubt, "err", err)
+	}
+	return fmt.Errorf("error: could not publish message after %d attempts: %w", o.attempts, err)
+}
+
+type confirmingPublisher struct {
+	ch *amqp.Channel
+}
+
+// NewConfirmingPublisher puts ch in confirm mode and returns a publisher
+// that only returns once the broker has taken responsibility for each
+// message. The channel should not be used to publish anything else.
+func NewConfirmingPublisher(ch *amqp.Channel) (Publisher, error) {
+	err := ch.Confirm(false)
+	if err != nil {
+		return nil, err
+	}
+	return confirmingPublisher{ch: ch}, nil
+}
+
+func (p confirmingPublisher) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	confirm, err := p.ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, immediate, msg)
+	if err != nil {
+		return err
+	}
+	// The message has been sent, so if no confirm comes the broker may
+	// still have it.
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnconfirmed, err)
+	}
+	if !acked {
+		return fmt.Errorf("error: broker refused message %s", msg.MessageId)
+	}
+	return nil
+}
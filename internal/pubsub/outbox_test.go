@@ -0,0 +1,102 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// scriptedPublisher fails with the next error in errs on each publish, and
+// succeeds once they run out.
+type scriptedPublisher struct {
+	errs []error
+	ids  []string
+	mu   *sync.Mutex
+}
+
+func (p *scriptedPublisher) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ids = append(p.ids, msg.MessageId)
+	if len(p.errs) == 0 {
+		return nil
+	}
+	err := p.errs[0]
+	p.errs = p.errs[1:]
+	return err
+}
+
+func newTestOutbox(errs ...error) (*Outbox, *scriptedPublisher) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	pub := &scriptedPublisher{errs: errs, mu: &sync.Mutex{}}
+	o := NewOutbox(pub)
+	o.SetRetries(2, time.Millisecond)
+	return o, pub
+}
+
+func TestOutboxGivesUpOnRefusedMessages(t *testing.T) {
+	refused := errors.New("refused")
+	o, pub := newTestOutbox(refused, refused)
+	defer o.Close()
+	applied := false
+	err := PostJSON(context.Background(), o, "exchange", "key", 1, func() { applied = true })
+	if !errors.Is(err, refused) {
+		t.Fatalf("expected the last error, got %v", err)
+	}
+	if applied {
+		t.Fatal("expected a message that was never published not to be applied")
+	}
+	if len(pub.ids) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(pub.ids))
+	}
+}
+
+func TestOutboxRetriesUnconfirmedMessagesUntilConfirmed(t *testing.T) {
+	// More unconfirmed attempts than the outbox usually makes.
+	o, pub := newTestOutbox(ErrUnconfirmed, ErrUnconfirmed, ErrUnconfirmed, ErrUnconfirmed)
+	defer o.Close()
+	applied := false
+	err := PostJSON(context.Background(), o, "exchange", "key", 1, func() { applied = true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !applied {
+		t.Fatal("expected a confirmed message to be applied")
+	}
+	if len(pub.ids) != 5 {
+		t.Fatalf("expected 5 attempts, got %d", len(pub.ids))
+	}
+	for _, id := range pub.ids {
+		if id != pub.ids[0] {
+			t.Fatalf("expected every copy to have the same ID, got %v", pub.ids)
+		}
+	}
+}
+
+func TestOutboxCloseEndsUnconfirmedRetries(t *testing.T) {
+	errs := make([]error, 1000)
+	for i := range errs {
+		errs[i] = ErrUnconfirmed
+	}
+	o, _ := newTestOutbox(errs...)
+	done := make(chan error, 1)
+	go func() {
+		done <- PostJSON(context.Background(), o, "exchange", "key", 1, nil)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	o.Close()
+	err := <-done
+	if !errors.Is(err, ErrUnconfirmed) {
+		t.Fatalf("expected ErrUnconfirmed, got %v", err)
+	}
+	err = PostJSON(context.Background(), o, "exchange", "key", 1, nil)
+	if !errors.Is(err, ErrOutboxClosed) {
+		t.Fatalf("expected ErrOutboxClosed, got %v", err)
+	}
+}
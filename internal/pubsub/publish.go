@@ -3,44 +3,91 @@ package pubsub
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
 	"encoding/gob"
+	"encoding/hex"
 	"encoding/json"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-func PublishGob[T any](ch *amqp.Channel, exchange, key string, val T) error {
+// Publisher is the part of *amqp.Channel used to publish messages, so that
+// anything that routes messages like a channel can stand in for one.
+type Publisher interface {
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+}
+
+func PublishGob[T any](ch Publisher, exchange, key string, val T) error {
+	return PublishGobWithContext(context.Background(), ch, exchange, key, val)
+}
+
+func PublishJSON[T any](ch Publisher, exchange, key string, val T) error {
+	return PublishJSONWithContext(context.Background(), ch, exchange, key, val)
+}
+
+// PublishGobWithContext publishes val as part of the trace in ctx, so that
+// whatever the message causes shows up in the same trace.
+func PublishGobWithContext[T any](ctx context.Context, ch Publisher, exchange, key string, val T) error {
+	return publishGob(ctx, ch, exchange, key, val, nil)
+}
+
+// ReasonHeader says why a message was sent to the dead letter exchange by
+// DeadLetterGob.
+const ReasonHeader = "x-peril-reason"
+
+// DeadLetterGob sends val to the dead letter exchange, under key, with the
+// reason it was refused. Rejecting a message sends it there too, but
+// RabbitMQ only records that it was rejected, not why. Ack the original
+// once this succeeds.
+func DeadLetterGob[T any](ctx context.Context, ch Publisher, key string, val T, reason string) error {
+	return publishGob(ctx, ch, DeadLetterExchange, key, val, amqp.Table{ReasonHeader: reason})
+}
+
+func publishGob[T any](ctx context.Context, ch Publisher, exchange, key string, val T, headers amqp.Table) error {
 	var buf bytes.Buffer
 	if err := gob.NewEncoder(&buf).Encode(val); err != nil {
 		return err
 	}
-	return ch.PublishWithContext(
-		context.Background(),
-		exchange,
-		key,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/gob",
-			Body:        buf.Bytes(),
-		},
-	)
-}
-
-func PublishJSON[T any](ch *amqp.Channel, exchange, key string, val T) error {
+	return publish(ctx, ch, exchange, key, amqp.Publishing{
+		ContentType: "application/gob",
+		Headers:     headers,
+		Body:        buf.Bytes(),
+	})
+}
+
+// PublishJSONWithContext publishes val as part of the trace in ctx, so that
+// whatever the message causes shows up in the same trace.
+func PublishJSONWithContext[T any](ctx context.Context, ch Publisher, exchange, key string, val T) error {
 	bytes, err := json.Marshal(val)
 	if err != nil {
 		return err
 	}
-	return ch.PublishWithContext(
-		context.Background(),
-		exchange,
-		key,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        bytes,
-		},
-	)
+	return publish(ctx, ch, exchange, key, amqp.Publishing{
+		ContentType: "application/json",
+		Body:        bytes,
+	})
+}
+
+// publish sends msg, giving it an ID first if it has none so that
+// consumers can tell when it has been delivered twice.
+func publish(ctx context.Context, ch Publisher, exchange, key string, msg amqp.Publishing) error {
+	if msg.MessageId == "" {
+		msg.MessageId = newMessageID()
+	}
+	ctx, span := startPublishSpan(ctx, exchange, key, &msg)
+	defer span.End()
+	err := ch.PublishWithContext(ctx, exchange, key, false, false, msg)
+	if err != nil {
+		recordError(span, err)
+		publishFailuresTotal.WithLabelValues(exchange, keyLabel(key)).Inc()
+		return err
+	}
+	publishedTotal.WithLabelValues(exchange, keyLabel(key)).Inc()
+	return nil
+}
+
+func newMessageID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
 }
@@ -11,8 +11,22 @@ const (
 	Transient
 )
 
+// DeadLetterExchange is where queues send the messages that consumers
+// reject without requeueing them.
+const DeadLetterExchange = "peril_dlx"
+
 var table = amqp.Table{
-	"x-dead-letter-exchange": "peril_dlx",
+	"x-dead-letter-exchange": DeadLetterExchange,
+}
+
+// durableQueueType is the RabbitMQ type of every durable queue.
+var durableQueueType = "classic"
+
+// SetQueueType chooses the RabbitMQ type, classic or quorum, of the durable
+// queues declared from now on. Transient queues are exclusive and can only
+// be classic.
+func SetQueueType(queueType string) {
+	durableQueueType = queueType
 }
 
 func DeclareAndBind(
@@ -26,13 +40,22 @@ func DeclareAndBind(
 	if err != nil {
 		return nil, amqp.Queue{}, err
 	}
+	args := amqp.Table{}
+	for k, v := range table {
+		args[k] = v
+	}
+	// Classic is left implicit so that queues declared before the type
+	// could be chosen still match.
+	if queueType == Durable && durableQueueType != "classic" {
+		args["x-queue-type"] = durableQueueType
+	}
 	q, err := ch.QueueDeclare(
 		queueName,
 		queueType == Durable,
 		queueType == Transient,
 		queueType == Transient,
 		false,
-		table,
+		args,
 	)
 	if err != nil {
 		return nil, amqp.Queue{}, err
@@ -2,11 +2,14 @@ package pubsub
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"encoding/json"
-	"log"
+	"log/slog"
+	"sync"
 
 	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type AckType int
@@ -17,6 +20,81 @@ const (
 	NackDiscard
 )
 
+// Acker settles a delivery. Only the first call counts, and it may be made
+// from any goroutine once the handler has returned.
+type Acker func(AckType)
+
+func (a AckType) String() string {
+	switch a {
+	case Ack:
+		return "ack"
+	case NackRequeue:
+		return "nack_requeue"
+	case NackDiscard:
+		return "nack_discard"
+	}
+	return "unknown"
+}
+
+type routingKeyCtxKey struct{}
+
+// RoutingKey returns the routing key of the message a handler was called
+// for. Handlers can use it to check the sender a per-player key names
+// against the one the message claims.
+func RoutingKey(ctx context.Context) string {
+	key, _ := ctx.Value(routingKeyCtxKey{}).(string)
+	return key
+}
+
+// Source declares a queue, binds it to an exchange and returns its
+// deliveries. A RabbitMQ connection is the usual source, but tests and
+// simulations can route messages in memory instead.
+type Source interface {
+	Deliveries(exchange, queueName, key string, queueType SimpleQueueType) (<-chan amqp.Delivery, error)
+}
+
+// prefetch is how many unacknowledged messages each consumer may hold.
+var prefetch = 10
+
+// SetPrefetch changes the prefetch of consumers started from now on. Zero
+// means no limit.
+func SetPrefetch(n int) {
+	prefetch = n
+}
+
+type connSource struct {
+	conn     *amqp.Connection
+	prefetch int
+}
+
+func NewConnSource(conn *amqp.Connection) Source {
+	return connSource{conn: conn, prefetch: -1}
+}
+
+// NewConnSourceWithPrefetch is NewConnSource with a prefetch of its own,
+// for consumers that hold on to many messages before settling them.
+func NewConnSourceWithPrefetch(conn *amqp.Connection, n int) Source {
+	return connSource{conn: conn, prefetch: n}
+}
+
+func (s connSource) Deliveries(exchange, queueName, key string, queueType SimpleQueueType) (<-chan amqp.Delivery, error) {
+	ch, q, err := DeclareAndBind(s.conn, exchange, queueName, key, queueType)
+	if err != nil {
+		return nil, err
+	}
+	// Every consumer has a channel of its own, so the limit is set per
+	// consumer, which quorum queues also support.
+	n := s.prefetch
+	if n < 0 {
+		n = prefetch
+	}
+	err = ch.Qos(n, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	return ch.Consume(q.Name, "", false, false, false, false, nil)
+}
+
 func SubscribeGob[T any](
 	conn *amqp.Connection,
 	exchange,
@@ -25,77 +103,173 @@ func SubscribeGob[T any](
 	queueType SimpleQueueType, // an enum to represent "durable" or "transient"
 	handler func(T) AckType,
 ) error {
-	return subscribe[T](conn, exchange, queueName, key, queueType, handler, func(b []byte) (T, error) {
+	return SubscribeGobFrom(NewConnSource(conn), exchange, queueName, key, queueType, handler)
+}
+
+func SubscribeJSON[T any](
+	conn *amqp.Connection,
+	exchange,
+	queueName,
+	key string,
+	queueType SimpleQueueType, // an enum to represent "durable" or "transient"
+	handler func(T) AckType,
+) error {
+	return SubscribeJSONFrom(NewConnSource(conn), exchange, queueName, key, queueType, handler)
+}
+
+func SubscribeGobFrom[T any](
+	src Source,
+	exchange,
+	queueName,
+	key string,
+	queueType SimpleQueueType,
+	handler func(T) AckType,
+) error {
+	return SubscribeGobWithContext(src, exchange, queueName, key, queueType, func(_ context.Context, msg T) AckType {
+		return handler(msg)
+	})
+}
+
+// SubscribeGobWithContext is SubscribeGobFrom for handlers that publish, or
+// otherwise want to carry on the trace of the message they are handling.
+func SubscribeGobWithContext[T any](
+	src Source,
+	exchange,
+	queueName,
+	key string,
+	queueType SimpleQueueType,
+	handler func(context.Context, T) AckType,
+) error {
+	return subscribe[T](src, exchange, queueName, key, queueType, handler, func(b []byte) (T, error) {
 		var msg T
 		err := gob.NewDecoder(bytes.NewReader(b)).Decode(&msg)
 		return msg, err
 	})
 }
 
-func SubscribeJSON[T any](
-	conn *amqp.Connection,
+func SubscribeJSONFrom[T any](
+	src Source,
 	exchange,
 	queueName,
 	key string,
-	queueType SimpleQueueType, // an enum to represent "durable" or "transient"
+	queueType SimpleQueueType,
 	handler func(T) AckType,
 ) error {
-	return subscribe[T](conn, exchange, queueName, key, queueType, handler, func(b []byte) (T, error) {
+	return SubscribeJSONWithContext(src, exchange, queueName, key, queueType, func(_ context.Context, msg T) AckType {
+		return handler(msg)
+	})
+}
+
+// SubscribeJSONWithContext is SubscribeJSONFrom for handlers that publish, or
+// otherwise want to carry on the trace of the message they are handling.
+func SubscribeJSONWithContext[T any](
+	src Source,
+	exchange,
+	queueName,
+	key string,
+	queueType SimpleQueueType,
+	handler func(context.Context, T) AckType,
+) error {
+	return subscribe[T](src, exchange, queueName, key, queueType, handler, func(b []byte) (T, error) {
 		var msg T
 		err := json.Unmarshal(b, &msg)
 		return msg, err
 	})
 }
 
+// SubscribeGobDeferred is SubscribeGobWithContext for handlers that settle
+// messages later, such as once a batch they are part of has been written.
+// The handler must call the Acker exactly once for every message. How many
+// messages can wait unsettled at a time is limited by the prefetch.
+func SubscribeGobDeferred[T any](
+	src Source,
+	exchange,
+	queueName,
+	key string,
+	queueType SimpleQueueType,
+	handler func(context.Context, T, Acker),
+) error {
+	return subscribeDeferred[T](src, exchange, queueName, key, queueType, handler, func(b []byte) (T, error) {
+		var msg T
+		err := gob.NewDecoder(bytes.NewReader(b)).Decode(&msg)
+		return msg, err
+	})
+}
+
 func subscribe[T any](
-	conn *amqp.Connection,
+	src Source,
 	exchange,
 	queueName,
 	key string,
 	queueType SimpleQueueType,
-	handler func(T) AckType,
+	handler func(context.Context, T) AckType,
 	unmarshaller func([]byte) (T, error),
 ) error {
-	ch, q, err := DeclareAndBind(conn, exchange, queueName, key, queueType)
-	if err != nil {
-		return err
-	}
-	err = ch.Qos(10, 0, true)
-	if err != nil {
-		return err
-	}
-	deliveriesCh, err := ch.Consume(q.Name, "", false, false, false, false, nil)
+	return subscribeDeferred(src, exchange, queueName, key, queueType, func(ctx context.Context, msg T, settle Acker) {
+		settle(handler(ctx, msg))
+	}, unmarshaller)
+}
+
+func subscribeDeferred[T any](
+	src Source,
+	exchange,
+	queueName,
+	key string,
+	queueType SimpleQueueType,
+	handler func(context.Context, T, Acker),
+	unmarshaller func([]byte) (T, error),
+) error {
+	deliveriesCh, err := src.Deliveries(exchange, queueName, key, queueType)
 	if err != nil {
 		return err
 	}
+	logger := slog.Default().With("queue", queueName)
 	go func() {
 		for delivery := range deliveriesCh {
+			ctx, span := startConsumeSpan(delivery)
+			ctx = context.WithValue(ctx, routingKeyCtxKey{}, delivery.RoutingKey)
+			exchange, key := delivery.Exchange, keyLabel(delivery.RoutingKey)
+			logger := logger.With("routing_key", delivery.RoutingKey, "message_id", delivery.MessageId)
+			consumedTotal.WithLabelValues(exchange, key).Inc()
 			msg, err := unmarshaller(delivery.Body)
 			if err != nil {
-				log.Printf("failed to unmarshal message: %v", err)
+				recordError(span, err)
+				decodeFailuresTotal.WithLabelValues(exchange, key).Inc()
+				nackedTotal.WithLabelValues(exchange, key, "false").Inc()
+				logger.Warn("discarding message that could not be decoded", "err", err)
 				err = delivery.Nack(false, false)
 				if err != nil {
-					log.Printf("failed to nack message: %v", err)
-				} else {
-					log.Println("nacked message without requeue - decoding body failed")
-				}
-			} else {
-				var err error
-				switch handler(msg) {
-				case Ack:
-					err = delivery.Ack(false)
-					log.Println("acknowledged message")
-				case NackRequeue:
-					err = delivery.Nack(false, true)
-					log.Println("nacked message with requeue")
-				case NackDiscard:
-					err = delivery.Nack(false, false)
-					log.Println("nacked message without requeue")
-				}
-				if err != nil {
-					log.Printf("failed to ack/nack message: %v", err)
+					logger.Error("failed to nack message", "err", err)
 				}
+				span.End()
+				continue
+			}
+
+			var once sync.Once
+			settle := func(ack AckType) {
+				once.Do(func() {
+					defer span.End()
+					span.SetAttributes(attribute.String("peril.ack", ack.String()))
+					var err error
+					switch ack {
+					case Ack:
+						err = delivery.Ack(false)
+						ackedTotal.WithLabelValues(exchange, key).Inc()
+					case NackRequeue:
+						err = delivery.Nack(false, true)
+						nackedTotal.WithLabelValues(exchange, key, "true").Inc()
+					case NackDiscard:
+						err = delivery.Nack(false, false)
+						nackedTotal.WithLabelValues(exchange, key, "false").Inc()
+					}
+					if err != nil {
+						logger.Error("failed to ack/nack message", "ack", ack.String(), "err", err)
+					} else {
+						logger.Debug("handled message", "ack", ack.String())
+					}
+				})
 			}
+			timeHandler(exchange, key, func() { handler(ctx, msg, settle) })
 		}
 	}()
 	return nil
@@ -0,0 +1,78 @@
+package pubsub
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trace context travels in the W3C traceparent and tracestate headers of
+// each message, whatever propagator the program has installed, so that
+// every binary agrees on the format. Spans go to the global tracer
+// provider and cost next to nothing until one is set up.
+var (
+	tracer     = otel.Tracer("github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub")
+	propagator = propagation.TraceContext{}
+)
+
+// headerCarrier lets the propagator read and write message headers.
+type headerCarrier amqp.Table
+
+func (c headerCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func spanAttributes(exchange, key string) trace.SpanStartOption {
+	return trace.WithAttributes(
+		attribute.String("messaging.system", "rabbitmq"),
+		attribute.String("messaging.destination.name", exchange),
+		attribute.String("messaging.rabbitmq.destination.routing_key", key),
+	)
+}
+
+// startPublishSpan starts a producer span and writes its context into the
+// message headers.
+func startPublishSpan(ctx context.Context, exchange, key string, msg *amqp.Publishing) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(ctx, "publish "+keyLabel(key),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		spanAttributes(exchange, key),
+	)
+	if msg.Headers == nil {
+		msg.Headers = amqp.Table{}
+	}
+	propagator.Inject(ctx, headerCarrier(msg.Headers))
+	return ctx, span
+}
+
+// startConsumeSpan starts a consumer span that continues the trace the
+// delivery was published in, if any.
+func startConsumeSpan(delivery amqp.Delivery) (context.Context, trace.Span) {
+	ctx := propagator.Extract(context.Background(), headerCarrier(delivery.Headers))
+	return tracer.Start(ctx, "process "+keyLabel(delivery.RoutingKey),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		spanAttributes(delivery.Exchange, delivery.RoutingKey),
+	)
+}
+
+func recordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter keeps a token bucket per key (usually a username). Each bucket
+// holds up to burst tokens and refills at rate tokens per second. Buckets
+// that have refilled are forgotten now and then, since a full bucket is
+// the same as a new one, so keys that stop being used don't pile up.
+type Limiter struct {
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	now       func() time.Time
+	lastPrune time.Time
+	mu        *sync.Mutex
+}
+
+// pruneEvery is how often a limiter looks for buckets to forget.
+const pruneEvery = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func New(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   map[string]*bucket{},
+		now:       time.Now,
+		lastPrune: time.Now(),
+		mu:        &sync.Mutex{},
+	}
+}
+
+// Allow takes a token from the key's bucket and reports whether there was
+// one to take.
+func (l *Limiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.refill(key)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Wait takes a token from the key's bucket, first waiting for one to be
+// added if it is empty. Callers that wait together are let through in
+// turn. A limiter with a rate of zero never adds tokens, so Wait only
+// waits when the rate is positive.
+func (l *Limiter) Wait(key string) {
+	l.mu.Lock()
+	b := l.refill(key)
+	b.tokens--
+	var wait time.Duration
+	if b.tokens < 0 && l.rate > 0 {
+		wait = time.Duration(-b.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	time.Sleep(wait)
+}
+
+// refill adds the tokens earned since the bucket was last used. Tokens
+// taken by Wait can leave it below zero until they are earned back.
+func (l *Limiter) refill(key string) *bucket {
+	now := l.now()
+	if now.Sub(l.lastPrune) >= pruneEvery {
+		l.prune(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	return b
+}
+
+// prune forgets the buckets that would be full by now. Buckets never
+// refill at a rate of zero, so then none are.
+func (l *Limiter) prune(now time.Time) {
+	l.lastPrune = now
+	if l.rate <= 0 {
+		return
+	}
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
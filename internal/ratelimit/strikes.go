@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Strikes counts offences per key (usually a username) so that repeat
+// offenders can be dealt with once they reach a limit. Strikes only count
+// within a window, so that occasional offences spread over a long game
+// never add up to the limit.
+type Strikes struct {
+	limit  int
+	window time.Duration
+	counts map[string]*strikeCount
+	now    func() time.Time
+	mu     *sync.Mutex
+}
+
+type strikeCount struct {
+	count int
+	since time.Time
+}
+
+// NewStrikes counts up to limit strikes within window of a key's first
+// strike. A limit of zero is never reached, and a window of zero never
+// ends.
+func NewStrikes(limit int, window time.Duration) *Strikes {
+	return &Strikes{
+		limit:  limit,
+		window: window,
+		counts: map[string]*strikeCount{},
+		now:    time.Now,
+		mu:     &sync.Mutex{},
+	}
+}
+
+// Add gives the key a strike and reports how many it has in the current
+// window. out is only true for the strike that reaches the limit, so
+// whatever happens then happens once.
+func (s *Strikes) Add(key string) (count int, out bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.prune(now)
+	c, ok := s.counts[key]
+	if !ok {
+		c = &strikeCount{since: now}
+		s.counts[key] = c
+	}
+	c.count++
+	return c.count, s.limit > 0 && c.count == s.limit
+}
+
+// prune forgets the keys whose window has ended.
+func (s *Strikes) prune(now time.Time) {
+	if s.window <= 0 {
+		return
+	}
+	for key, c := range s.counts {
+		if now.Sub(c.since) >= s.window {
+			delete(s.counts, key)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package referee
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	movesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "peril_moves_total",
+		Help: "Moves seen by the referee.",
+	})
+	spawnsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_spawns_total",
+		Help: "Units spawned, by rank.",
+	}, []string{"rank"})
+	warsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "peril_wars_total",
+		Help: "Wars resolved, by outcome: attacker_won, defender_won or draw.",
+	}, []string{"outcome"})
+	kicksTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "peril_kicks_total",
+		Help: "Players kicked from the game.",
+	})
+	gamesEndedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "peril_games_ended_total",
+		Help: "Games ended by a victory condition.",
+	})
+)
+
+func warOutcome(attacker, winner string, draw bool) string {
+	switch {
+	case draw:
+		return "draw"
+	case winner == attacker:
+		return "attacker_won"
+	}
+	return "defender_won"
+}
@@ -0,0 +1,356 @@
+package referee
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/ratelimit"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// Referee tracks territory from the moves, spawns and war results published
+// by clients, relays each move only to the players who can see it, and ends
+// the game as soon as a victory condition is met.
+type Referee struct {
+	Tracker    *gamelogic.TerritoryTracker
+	conditions []gamelogic.VictoryCondition
+	pub        pubsub.Publisher
+	writeLog   func(routing.GameLog) error
+	now        func() time.Time
+	out        io.Writer
+	over       bool
+	kicked     map[string]bool
+	strikes    *ratelimit.Strikes
+	mu         *sync.Mutex
+}
+
+// New creates a referee that publishes through pub and writes the final
+// standings with writeLog.
+func New(pub pubsub.Publisher, conditions []gamelogic.VictoryCondition, writeLog func(routing.GameLog) error) *Referee {
+	return &Referee{
+		Tracker:    gamelogic.NewTerritoryTracker(),
+		conditions: conditions,
+		pub:        pub,
+		writeLog:   writeLog,
+		now:        time.Now,
+		out:        os.Stdout,
+		kicked:     map[string]bool{},
+		mu:         &sync.Mutex{},
+	}
+}
+
+// SetClock replaces the wall clock, so that simulations can expire time
+// limits on demand.
+func (r *Referee) SetClock(now func() time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.now = now
+}
+
+// SetStrikes has the referee kick players once they reach the strikes'
+// limit. Without it strikes are ignored.
+func (r *Referee) SetStrikes(strikes *ratelimit.Strikes) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.strikes = strikes
+}
+
+// RequestKick asks the referee, on whichever server it runs, to kick a
+// player.
+func RequestKick(pub pubsub.Publisher, username, reason string) error {
+	return pubsub.PublishJSON(pub, routing.ExchangePerilDirect, routing.KickRequestsKey, routing.Kick{
+		Username: username,
+		Reason:   reason,
+		KickedAt: time.Now(),
+	})
+}
+
+// Subscribe starts consuming the moves, spawns and war results of every
+// player, and the kick requests and strikes sent by any server.
+func (r *Referee) Subscribe(src pubsub.Source) error {
+	err := pubsub.SubscribeJSONFrom(
+		src,
+		routing.ExchangePerilDirect,
+		routing.KickRequestsKey,
+		routing.KickRequestsKey,
+		pubsub.Durable,
+		r.handlerKickRequest(),
+	)
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSONFrom(
+		src,
+		routing.ExchangePerilDirect,
+		routing.StrikesKey,
+		routing.StrikesKey,
+		pubsub.Durable,
+		r.handlerStrike(),
+	)
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSONWithContext(
+		src,
+		routing.ExchangePerilTopic,
+		routing.ArmyMovesPrefix+"."+routing.ServerUsername,
+		routing.ArmyMovesPrefix+".*",
+		pubsub.Transient,
+		r.handlerMove(),
+	)
+	if err != nil {
+		return err
+	}
+	err = pubsub.SubscribeJSONWithContext(
+		src,
+		routing.ExchangePerilTopic,
+		routing.ArmySpawnsPrefix+"."+routing.ServerUsername,
+		routing.ArmySpawnsPrefix+".*",
+		pubsub.Transient,
+		r.handlerSpawn(),
+	)
+	if err != nil {
+		return err
+	}
+	return pubsub.SubscribeJSONWithContext(
+		src,
+		routing.ExchangePerilTopic,
+		routing.WarResultsPrefix+"."+routing.ServerUsername,
+		routing.WarResultsPrefix+".*",
+		pubsub.Transient,
+		r.handlerWarResult(),
+	)
+}
+
+// SetOutput decides where the referee announces the end of the game. The
+// default is stdout.
+func (r *Referee) SetOutput(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.out = w
+}
+
+func (r *Referee) getNow() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.now()
+}
+
+// Kick removes a player from the game: they are told so, their units are
+// taken off the map and anything else they publish is ignored. It reports
+// whether the referee knew of the player.
+func (r *Referee) Kick(username, reason string) (bool, error) {
+	now := r.getNow()
+	err := pubsub.PublishJSON(r.pub, routing.ExchangePerilDirect, routing.KickPrefix+"."+username, routing.Kick{
+		Username: username,
+		Reason:   reason,
+		KickedAt: now,
+	})
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	r.kicked[username] = true
+	r.mu.Unlock()
+
+	kicksTotal.Inc()
+	known := r.Tracker.RemovePlayer(username)
+
+	message := "Kicked " + username
+	if reason != "" {
+		message += ": " + reason
+	}
+	err = r.writeLog(routing.GameLog{
+		Username:    routing.ServerUsername,
+		Message:     message,
+		CurrentTime: now,
+	})
+	if err != nil {
+		slog.Error("could not write kick to the game log", "username", username, "err", err)
+	}
+	r.Check(now)
+	return known, nil
+}
+
+func (r *Referee) isKicked(username string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.kicked[username]
+}
+
+func (r *Referee) handlerKickRequest() func(routing.Kick) pubsub.AckType {
+	return func(k routing.Kick) pubsub.AckType {
+		if r.isKicked(k.Username) {
+			return pubsub.Ack
+		}
+		_, err := r.Kick(k.Username, k.Reason)
+		if err != nil {
+			slog.Error("could not kick player", "username", k.Username, "err", err)
+			return pubsub.NackRequeue
+		}
+		return pubsub.Ack
+	}
+}
+
+// handlerStrike counts strikes from every server in one place, so that a
+// player is kicked after the same number of them however many servers
+// share the work.
+func (r *Referee) handlerStrike() func(routing.Strike) pubsub.AckType {
+	return func(s routing.Strike) pubsub.AckType {
+		r.mu.Lock()
+		strikes := r.strikes
+		r.mu.Unlock()
+		if strikes == nil || r.isKicked(s.Username) {
+			return pubsub.Ack
+		}
+		count, out := strikes.Add(s.Username)
+		if count == 1 {
+			slog.Warn("player has a strike", "username", s.Username, "reason", s.Reason)
+		}
+		if !out {
+			return pubsub.Ack
+		}
+		slog.Warn("kicking player for too many strikes", "username", s.Username, "reason", s.Reason, "strikes", count)
+		// The strike has been counted, so it is not requeued even if
+		// the kick fails.
+		_, err := r.Kick(s.Username, s.Reason)
+		if err != nil {
+			slog.Error("could not kick player", "username", s.Username, "err", err)
+		}
+		return pubsub.Ack
+	}
+}
+
+func (r *Referee) handlerMove() func(context.Context, gamelogic.ArmyMove) pubsub.AckType {
+	return func(ctx context.Context, move gamelogic.ArmyMove) pubsub.AckType {
+		if r.isKicked(move.Username) {
+			return pubsub.Ack
+		}
+		movesTotal.Inc()
+		r.Tracker.ApplyMove(move)
+		for _, observer := range r.Tracker.Observers(move.ToLocation, move.Username) {
+			err := pubsub.PublishJSONWithContext(ctx, r.pub, routing.ExchangePerilTopic, routing.VisibleMovesPrefix+"."+observer, move)
+			if err != nil {
+				slog.Error("could not relay move", "username", move.Username, "observer", observer, "err", err)
+				return pubsub.NackRequeue
+			}
+		}
+		r.sendSightings(ctx, move.Username)
+		r.Check(r.getNow())
+		return pubsub.Ack
+	}
+}
+
+func (r *Referee) handlerSpawn() func(context.Context, gamelogic.ArmySpawn) pubsub.AckType {
+	return func(ctx context.Context, spawn gamelogic.ArmySpawn) pubsub.AckType {
+		if r.isKicked(spawn.Username) {
+			return pubsub.Ack
+		}
+		spawnsTotal.WithLabelValues(string(spawn.Unit.Rank)).Inc()
+		r.Tracker.ApplySpawn(spawn)
+		observers := r.Tracker.Observers(spawn.Unit.Location, spawn.Username)
+		r.sendSightings(ctx, append(observers, spawn.Username)...)
+		r.Check(r.getNow())
+		return pubsub.Ack
+	}
+}
+
+func (r *Referee) handlerWarResult() func(context.Context, gamelogic.WarResult) pubsub.AckType {
+	return func(ctx context.Context, wr gamelogic.WarResult) pubsub.AckType {
+		if r.isKicked(wr.Attacker) {
+			return pubsub.Ack
+		}
+		warsTotal.WithLabelValues(warOutcome(wr.Attacker, wr.Winner, wr.Draw)).Inc()
+		r.Tracker.ApplyWarResult(wr)
+		r.sendSightings(ctx, wr.Attacker, wr.Defender)
+		r.Check(r.getNow())
+		return pubsub.Ack
+	}
+}
+
+// sendSightings tells each player what their units can currently see, as
+// part of the trace in ctx.
+func (r *Referee) sendSightings(ctx context.Context, usernames ...string) {
+	now := r.getNow()
+	for _, username := range usernames {
+		report := r.Tracker.VisibleTo(username, now)
+		err := pubsub.PublishJSONWithContext(ctx, r.pub, routing.ExchangePerilTopic, routing.SightingsPrefix+"."+username, report)
+		if err != nil {
+			slog.Error("could not publish sightings", "username", username, "err", err)
+		}
+	}
+}
+
+// Watch checks the victory conditions once a second so that time limits
+// expire even when nobody is moving.
+func (r *Referee) Watch() {
+	for range time.Tick(time.Second) {
+		if r.Check(r.getNow()) {
+			return
+		}
+	}
+}
+
+// Check ends the game if any victory condition is met and reports whether
+// the game is over.
+func (r *Referee) Check(now time.Time) bool {
+	r.mu.Lock()
+	if r.over {
+		r.mu.Unlock()
+		return true
+	}
+	standings := r.Tracker.Standings()
+	for _, condition := range r.conditions {
+		winner, reason, over := condition.Check(standings, now)
+		if !over {
+			continue
+		}
+		r.over = true
+		r.mu.Unlock()
+		gamesEndedTotal.Inc()
+		r.endGame(routing.GameOver{
+			Winner:    winner,
+			Reason:    reason,
+			Standings: standings,
+			EndTime:   now,
+		})
+		return true
+	}
+	r.mu.Unlock()
+	return false
+}
+
+func (r *Referee) endGame(over routing.GameOver) {
+	r.mu.Lock()
+	out := r.out
+	r.mu.Unlock()
+	text := fmt.Sprintf("\nGame over: %s\nFinal standings:\n", over.Reason)
+	for _, line := range gamelogic.FormatStandings(over.Standings) {
+		text += line + "\n"
+	}
+	io.WriteString(out, text)
+
+	err := pubsub.PublishJSON(r.pub, routing.ExchangePerilDirect, routing.GameOverKey, over)
+	if err != nil {
+		slog.Error("could not publish game over", "err", err)
+	}
+
+	lines := append([]string{"Game over: " + over.Reason}, gamelogic.FormatStandings(over.Standings)...)
+	for _, line := range lines {
+		err := r.writeLog(routing.GameLog{
+			Username:    routing.ServerUsername,
+			Message:     line,
+			CurrentTime: over.EndTime,
+		})
+		if err != nil {
+			slog.Error("could not write standings to the game log", "err", err)
+		}
+	}
+}
@@ -11,3 +11,44 @@ type GameLog struct {
 	Message     string
 	Username    string
 }
+
+type Standing struct {
+	Username   string
+	Score      int
+	Power      int
+	Units      int
+	Locations  int
+	Eliminated bool
+}
+
+type GameOver struct {
+	Winner    string
+	Reason    string
+	Standings []Standing
+	EndTime   time.Time
+}
+
+type ChatMessage struct {
+	From       string
+	Channel    string
+	Game       string
+	Recipients []string
+	Text       string
+	SentAt     time.Time
+}
+
+// Kick removes a player from the game. It is sent on the direct exchange
+// to that player alone, and to the referee to ask for the kick.
+type Kick struct {
+	Username string
+	Reason   string
+	KickedAt time.Time
+}
+
+// Strike counts against a player who broke a rule, such as a rate limit.
+// Strikes go to the referee, which kicks players who collect too many.
+type Strike struct {
+	Username string
+	Reason   string
+	At       time.Time
+}
@@ -1,16 +1,108 @@
 package routing
 
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
 const (
 	ArmyMovesPrefix = "army_moves"
 
+	ArmySpawnsPrefix = "army_spawns"
+
+	VisibleMovesPrefix = "visible_moves"
+
+	SightingsPrefix = "sightings"
+
 	WarRecognitionsPrefix = "war"
 
+	WarResultsPrefix = "war_results"
+
+	DiplomacyPrefix = "diplomacy"
+
+	ChatRequestsPrefix = "chat_requests"
+	ChatPrefix         = "chat"
+
 	PauseKey = "pause"
 
+	GameOverKey = "game_over"
+
+	KickPrefix = "kick"
+
+	// Kick requests and strikes go on the direct exchange to the server
+	// refereeing the game, whichever server they come from.
+	KickRequestsKey = "kick_requests"
+	StrikesKey      = "strikes"
+
 	GameLogSlug = "game_logs"
 )
 
-const (
+// The exchanges can be renamed by the config package at startup, before
+// anything is published or subscribed.
+var (
 	ExchangePerilDirect = "peril_direct"
 	ExchangePerilTopic  = "peril_topic"
 )
+
+const (
+	ChatGlobal   = "global"
+	ChatGame     = "game"
+	ChatAlliance = "alliance"
+	ChatWhisper  = "whisper"
+)
+
+const DefaultGame = "peril"
+
+// KeyUsername returns the username at the end of a per-player routing key
+// such as game_logs.<username>, and whether key has that prefix at all.
+func KeyUsername(prefix, key string) (string, bool) {
+	username, ok := strings.CutPrefix(key, prefix+".")
+	return username, ok && username != ""
+}
+
+// DiplomacyKey is the routing key of a diplomatic message from one player
+// to another. It names the sender so that nobody can speak for someone
+// else.
+func DiplomacyKey(from, to string) string {
+	return DiplomacyPrefix + "." + from + "." + to
+}
+
+// DiplomacyParties returns the sender and recipient a diplomacy routing key
+// names.
+func DiplomacyParties(key string) (from, to string, ok bool) {
+	rest, ok := KeyUsername(DiplomacyPrefix, key)
+	if !ok {
+		return "", "", false
+	}
+	from, to, ok = strings.Cut(rest, ".")
+	return from, to, ok && from != "" && to != ""
+}
+
+// ServerUsername identifies the server in queue names, game logs and chat.
+const ServerUsername = "server"
+
+// namePattern keeps usernames and game names to what is safe as one word of
+// a routing key: no dots, which separate words, and no * or #, which match
+// them.
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ValidateUsername checks that a player may use username, wherever it was
+// typed in.
+func ValidateUsername(username string) error {
+	if !namePattern.MatchString(username) {
+		return fmt.Errorf("error: %q is not a valid username, use 1 to 32 letters, digits, dashes or underscores", username)
+	}
+	if username == ServerUsername {
+		return fmt.Errorf("error: %s is reserved for the server", username)
+	}
+	return nil
+}
+
+// ValidateGame checks that game is safe to use as a game name.
+func ValidateGame(game string) error {
+	if !namePattern.MatchString(game) {
+		return fmt.Errorf("error: %q is not a valid game, use 1 to 32 letters, digits, dashes or underscores", game)
+	}
+	return nil
+}
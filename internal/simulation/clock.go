@@ -0,0 +1,37 @@
+package simulation
+
+import (
+	"sync"
+	"time"
+)
+
+// Epoch is the time every simulation starts at, so that timestamps in game
+// logs and sightings are the same on every run.
+var Epoch = time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+// Clock is a virtual clock that only moves when told to.
+type Clock struct {
+	now time.Time
+	mu  *sync.Mutex
+}
+
+func NewClock(start time.Time) *Clock {
+	return &Clock{
+		now: start,
+		mu:  &sync.Mutex{},
+	}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d and returns the new time.
+func (c *Clock) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
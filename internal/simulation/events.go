@@ -0,0 +1,71 @@
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Event is one message published during a simulation, by a player or by
+// the referee.
+type Event struct {
+	Exchange    string
+	Key         string
+	ContentType string
+	Body        []byte
+}
+
+// Decode unmarshals the body of an event into msg, using gob or JSON
+// depending on how it was published.
+func (e Event) Decode(msg any) error {
+	if e.ContentType == "application/gob" {
+		return gob.NewDecoder(bytes.NewReader(e.Body)).Decode(msg)
+	}
+	return json.Unmarshal(e.Body, msg)
+}
+
+// recorder remembers everything published through it before passing it on.
+type recorder struct {
+	pubsub.Publisher
+	events []Event
+	mu     *sync.Mutex
+}
+
+func newRecorder(pub pubsub.Publisher) *recorder {
+	return &recorder{
+		Publisher: pub,
+		mu:        &sync.Mutex{},
+	}
+}
+
+func (r *recorder) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	r.mu.Lock()
+	r.events = append(r.events, Event{
+		Exchange:    exchange,
+		Key:         key,
+		ContentType: msg.ContentType,
+		Body:        msg.Body,
+	})
+	r.mu.Unlock()
+	return r.Publisher.PublishWithContext(ctx, exchange, key, mandatory, immediate, msg)
+}
+
+// matching returns the recorded events whose routing key is prefix or
+// starts with prefix followed by a dot.
+func (r *recorder) matching(prefix string) []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := []Event{}
+	for _, e := range r.events {
+		if e.Key == prefix || strings.HasPrefix(e.Key, prefix+".") {
+			events = append(events, e)
+		}
+	}
+	return events
+}
@@ -0,0 +1,132 @@
+package simulation
+
+import (
+	"fmt"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// The Expect methods check the state of the simulation and fail it when
+// the state is not what the script expected.
+
+func (s *Sim) expect(ok bool, format string, args ...any) {
+	if s.err != nil || ok {
+		return
+	}
+	s.fail(fmt.Errorf("expected "+format, args...))
+}
+
+// ExpectUnits checks how many units a player has left.
+func (s *Sim) ExpectUnits(username string, n int) {
+	gs := s.Player(username)
+	if gs == nil {
+		return
+	}
+	got := len(gs.GetPlayerSnap().Units)
+	s.expect(got == n, "%s to have %d unit(s), got %d", username, n, got)
+}
+
+// ExpectUnitAt checks that a player's unit exists and is in loc.
+func (s *Sim) ExpectUnitAt(username string, id int, loc gamelogic.Location) {
+	gs := s.Player(username)
+	if gs == nil {
+		return
+	}
+	unit, ok := gs.GetUnit(id)
+	s.expect(ok, "%s to have unit %d", username, id)
+	s.expect(unit.Location == loc, "%s's unit %d to be in %s, got %s", username, id, loc, unit.Location)
+}
+
+// ExpectSighting checks whether a player has seen an enemy unit.
+func (s *Sim) ExpectSighting(username, enemy string, id int, seen bool) {
+	gs := s.Player(username)
+	if gs == nil {
+		return
+	}
+	ok := false
+	for _, sighting := range gs.GetSightingsSnap() {
+		if sighting.Username == enemy && sighting.Unit.ID == id {
+			ok = true
+		}
+	}
+	if seen {
+		s.expect(ok, "%s to have seen %s's unit %d", username, enemy, id)
+	} else {
+		s.expect(!ok, "%s not to have seen %s's unit %d", username, enemy, id)
+	}
+}
+
+func (s *Sim) ExpectPaused(username string, paused bool) {
+	gs := s.Player(username)
+	if gs == nil {
+		return
+	}
+	s.expect(gs.IsPaused() == paused, "%s paused to be %v", username, paused)
+}
+
+func (s *Sim) ExpectOver(username string, over bool) {
+	gs := s.Player(username)
+	if gs == nil {
+		return
+	}
+	s.expect(gs.IsOver() == over, "%s's game over to be %v", username, over)
+}
+
+// ExpectOwner checks who the referee thinks controls a location. An empty
+// username means nobody does.
+func (s *Sim) ExpectOwner(loc gamelogic.Location, username string) {
+	got := s.Referee.Tracker.Owners()[loc]
+	s.expect(got == username, "%s to be controlled by %q, got %q", loc, username, got)
+}
+
+// ExpectEvents checks how many messages were published with a routing key
+// under prefix.
+func (s *Sim) ExpectEvents(prefix string, n int) {
+	got := len(s.Events(prefix))
+	s.expect(got == n, "%d %s message(s), got %d", n, prefix, got)
+}
+
+// ExpectWinner checks the last game over message published by the referee.
+func (s *Sim) ExpectWinner(username string) {
+	events := s.Events(routing.GameOverKey)
+	s.expect(len(events) > 0, "the game to be over")
+	if s.err != nil {
+		return
+	}
+	var over routing.GameOver
+	err := events[len(events)-1].Decode(&over)
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	s.expect(over.Winner == username, "%q to win, got %q (%s)", username, over.Winner, over.Reason)
+}
+
+// ExpectPresented checks how many events of a kind, such as "war_fought",
+// a player has been shown.
+func (s *Sim) ExpectPresented(username, kind string, n int) {
+	got := 0
+	for _, e := range s.Presented(username) {
+		if e.Kind() == kind {
+			got++
+		}
+	}
+	s.expect(got == n, "%s to be shown %d %s event(s), got %d", username, n, kind, got)
+}
+
+// LastWarResult decodes the most recent war result, failing the simulation
+// if there was none.
+func (s *Sim) LastWarResult() gamelogic.WarResult {
+	events := s.Events(routing.WarResultsPrefix)
+	s.expect(len(events) > 0, "a war to have been fought")
+	if s.err != nil {
+		return gamelogic.WarResult{}
+	}
+	var wr gamelogic.WarResult
+	err := events[len(events)-1].Decode(&wr)
+	if err != nil {
+		s.fail(err)
+	}
+	return wr
+}
@@ -0,0 +1,331 @@
+package simulation
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/ratelimit"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/referee"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// Scenario is a scripted game with a known ending.
+type Scenario struct {
+	Name    string
+	Options Options
+	Script  func(s *Sim)
+}
+
+// Run plays the scenario in a fresh simulation and returns the first thing
+// that did not go as expected.
+func (sc Scenario) Run() error {
+	s, err := New(sc.Options)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	sc.Script(s)
+	return s.Err()
+}
+
+// Scenarios returns the built-in scenarios covering moves, wars and pauses.
+func Scenarios() []Scenario {
+	return []Scenario{
+		{
+			Name:    "moves-out-of-sight",
+			Options: Options{Players: []string{"alice", "bob"}, Seed: 1},
+			Script: func(s *Sim) {
+				s.Do("alice", "spawn australia infantry")
+				s.Do("bob", "spawn europe infantry")
+				s.ExpectSighting("alice", "bob", 1, false)
+
+				// Americas does not border Australia, so Alice does
+				// not hear about this move.
+				s.Do("bob", "move americas 1")
+				s.ExpectEvents(routing.VisibleMovesPrefix+".alice", 0)
+				s.ExpectSighting("alice", "bob", 1, false)
+
+				// Asia does.
+				s.Do("bob", "move asia 1")
+				s.ExpectEvents(routing.VisibleMovesPrefix+".alice", 1)
+				s.ExpectSighting("alice", "bob", 1, true)
+				s.ExpectEvents(routing.WarRecognitionsPrefix, 0)
+				s.ExpectUnitAt("bob", 1, "asia")
+			},
+		},
+		{
+			Name:    "war-defender-holds",
+			Options: Options{Players: []string{"alice", "bob"}, Seed: 1},
+			Script: func(s *Sim) {
+				s.Do("alice", "spawn europe artillery")
+				s.Do("bob", "spawn asia infantry")
+				s.Do("bob", "move europe 1")
+				s.ExpectEvents(routing.WarRecognitionsPrefix, 1)
+				s.ExpectEvents(routing.WarResultsPrefix, 1)
+				s.ExpectUnits("alice", 1)
+				s.ExpectUnits("bob", 0)
+				s.ExpectOwner("europe", "alice")
+				s.ExpectSighting("alice", "bob", 1, false)
+				s.ExpectPresented("alice", gamelogic.WarFought{}.Kind(), 1)
+				s.ExpectPresented("bob", gamelogic.WarResultReceived{}.Kind(), 1)
+			},
+		},
+		{
+			Name:    "war-draw",
+			Options: Options{Players: []string{"alice", "bob"}, Seed: 1},
+			Script: func(s *Sim) {
+				s.Do("alice", "spawn europe infantry")
+				s.Do("bob", "spawn asia infantry")
+				s.Do("bob", "move europe 1")
+				s.ExpectUnits("alice", 0)
+				s.ExpectUnits("bob", 0)
+				s.ExpectOwner("europe", "")
+			},
+		},
+		{
+			Name:    "war-counts-stationed-units",
+			Options: Options{Players: []string{"alice", "bob"}, Seed: 1},
+			Script: func(s *Sim) {
+				// Spawning does not start a war, so both sides can hold
+				// Europe before Bob moves in.
+				s.Do("alice", "spawn europe cavalry")
+				s.Do("bob", "spawn europe artillery")
+				s.Do("bob", "spawn asia infantry")
+				s.Do("bob", "move europe 2")
+				s.ExpectEvents(routing.WarRecognitionsPrefix, 1)
+				s.ExpectUnits("alice", 0)
+				s.ExpectUnits("bob", 2)
+			},
+		},
+		{
+			Name:    "unit-ids-not-reused",
+			Options: Options{Players: []string{"alice", "bob"}, Seed: 1},
+			Script: func(s *Sim) {
+				s.Do("alice", "spawn europe infantry")
+				s.Do("alice", "spawn asia infantry")
+				s.Do("bob", "spawn asia artillery")
+				s.Do("bob", "move europe 1")
+				s.ExpectUnits("alice", 1)
+
+				// Unit 1 is gone, but the next unit must not take the
+				// ID of unit 2.
+				s.Do("alice", "spawn europe cavalry")
+				s.ExpectUnits("alice", 2)
+				s.ExpectUnitAt("alice", 2, "asia")
+				s.ExpectUnitAt("alice", 3, "europe")
+			},
+		},
+		{
+			Name:    "pact-keeps-the-peace",
+			Options: Options{Players: []string{"alice", "bob"}, Seed: 1},
+			Script: func(s *Sim) {
+				s.Do("alice", "propose bob alliance")
+				s.Do("bob", "accept alice")
+				s.Do("alice", "spawn europe artillery")
+				s.Do("bob", "spawn asia infantry")
+				s.Do("bob", "move europe 1")
+				s.ExpectEvents(routing.WarRecognitionsPrefix, 0)
+				s.ExpectUnits("alice", 1)
+				s.ExpectUnits("bob", 1)
+
+				s.Do("bob", "break alice")
+				s.Do("bob", "move asia 1")
+				s.Do("bob", "move europe 1")
+				s.ExpectEvents(routing.WarRecognitionsPrefix, 1)
+				s.ExpectUnits("bob", 0)
+			},
+		},
+		{
+			Name:    "nonaggression-keeps-out",
+			Options: Options{Players: []string{"alice", "bob"}, Seed: 1},
+			Script: func(s *Sim) {
+				s.Do("alice", "propose bob nonaggression")
+				s.Do("bob", "accept alice")
+				s.Do("alice", "spawn australia artillery")
+				s.Do("alice", "spawn antarctica artillery")
+				s.Do("bob", "spawn europe infantry")
+				s.Do("bob", "move asia 1")
+				s.ExpectSighting("alice", "bob", 1, true)
+				s.ExpectSighting("bob", "alice", 1, true)
+
+				// They have seen each other, so the pact keeps each out
+				// of the other's location.
+				if err := s.Try("alice", "move asia 1"); err == nil {
+					s.fail(fmt.Errorf("expected moving in on a nonaggression partner to fail"))
+				}
+				if err := s.Try("bob", "move australia 1"); err == nil {
+					s.fail(fmt.Errorf("expected moving in on a nonaggression partner to fail"))
+				}
+				s.ExpectUnitAt("alice", 1, "australia")
+
+				// Bob has not seen Alice in Antarctica, so nothing stops
+				// him, but moving in on her there breaks the pact.
+				s.ExpectSighting("bob", "alice", 2, false)
+				s.Do("bob", "move antarctica 1")
+				s.ExpectEvents(routing.WarRecognitionsPrefix, 1)
+				s.ExpectUnits("bob", 0)
+				for _, p := range [][2]string{{"alice", "bob"}, {"bob", "alice"}} {
+					_, ok := s.Player(p[0]).GetPact(p[1])
+					s.expect(!ok, "%s's pact with %s to be broken", p[0], p[1])
+				}
+			},
+		},
+		{
+			Name:    "forged-diplomacy-ignored",
+			Options: Options{Players: []string{"alice", "bob", "carol"}, Seed: 1},
+			Script: func(s *Sim) {
+				s.Do("alice", "propose bob alliance")
+				// Carol can only publish under her own name, so her
+				// acceptance in Bob's name is dropped.
+				s.Publish(routing.DiplomacyKey("carol", "alice"), gamelogic.Diplomacy{
+					From:   "bob",
+					To:     "alice",
+					Action: gamelogic.DiplomacyAccept,
+				})
+				_, ok := s.Player("alice").GetPact("bob")
+				s.expect(!ok, "alice not to have a pact with bob")
+
+				s.Do("bob", "accept alice")
+				_, ok = s.Player("alice").GetPact("bob")
+				s.expect(ok, "alice to have a pact with bob")
+			},
+		},
+		{
+			Name:    "pause-blocks-moves",
+			Options: Options{Players: []string{"alice", "bob"}, Seed: 1},
+			Script: func(s *Sim) {
+				s.Do("alice", "spawn europe infantry")
+				s.Pause()
+				s.ExpectPaused("alice", true)
+				s.ExpectPaused("bob", true)
+				s.ExpectPresented("bob", gamelogic.Paused{}.Kind(), 1)
+				if err := s.Try("alice", "move asia 1"); err == nil {
+					s.fail(fmt.Errorf("expected moving while paused to fail"))
+				}
+				s.ExpectUnitAt("alice", 1, "europe")
+				s.ExpectEvents(routing.ArmyMovesPrefix, 0)
+
+				s.Resume()
+				s.ExpectPaused("alice", false)
+				s.Do("alice", "move asia 1")
+				s.ExpectUnitAt("alice", 1, "asia")
+				s.ExpectEvents(routing.ArmyMovesPrefix, 1)
+			},
+		},
+		{
+			Name:    "kick-removes-player",
+			Options: Options{Players: []string{"alice", "bob"}, Seed: 1},
+			Script: func(s *Sim) {
+				s.Do("alice", "spawn europe infantry")
+				s.Do("bob", "spawn asia infantry")
+				s.Kick("bob", "cheating")
+				s.ExpectOver("bob", true)
+				s.ExpectOver("alice", false)
+				s.ExpectPresented("bob", gamelogic.Kicked{}.Kind(), 1)
+				if err := s.Try("bob", "spawn asia infantry"); err == nil {
+					s.fail(fmt.Errorf("expected spawning after being kicked to fail"))
+				}
+				if _, ok := s.Referee.Tracker.Units("bob"); ok {
+					s.fail(fmt.Errorf("expected bob to be off the map"))
+				}
+
+				// Nothing Bob publishes counts any more, war results
+				// included.
+				s.Publish(routing.WarResultsPrefix+".bob", gamelogic.WarResult{
+					Attacker:           "bob",
+					Defender:           "alice",
+					Location:           "europe",
+					Winner:             "bob",
+					Loser:              "alice",
+					DefenderCasualties: []int{1},
+				})
+				s.ExpectOwner("europe", "alice")
+			},
+		},
+		{
+			Name:    "kicks-from-other-servers",
+			Options: Options{Players: []string{"alice", "bob", "carol"}, Seed: 1},
+			Script: func(s *Sim) {
+				// Servers that are not refereeing send kicks and
+				// strikes through the broker.
+				s.Referee.SetStrikes(ratelimit.NewStrikes(2, 0))
+				strike := routing.Strike{Username: "bob", Reason: "flooding the game log"}
+				s.publishTo(routing.ExchangePerilDirect, routing.StrikesKey, strike)
+				s.ExpectOver("bob", false)
+				s.publishTo(routing.ExchangePerilDirect, routing.StrikesKey, strike)
+				s.ExpectOver("bob", true)
+				s.ExpectPresented("bob", gamelogic.Kicked{}.Kind(), 1)
+
+				err := referee.RequestKick(s.events, "carol", "cheating")
+				if err != nil {
+					s.fail(err)
+				}
+				s.Settle()
+				s.ExpectOver("carol", true)
+				s.ExpectOver("alice", false)
+			},
+		},
+		{
+			Name:    "eliminate-opponents",
+			Options: Options{Players: []string{"alice", "bob"}, Seed: 1, Victory: "eliminate"},
+			Script: func(s *Sim) {
+				s.Do("alice", "spawn europe cavalry")
+				s.Do("bob", "spawn asia infantry")
+				s.ExpectOver("alice", false)
+				s.Do("bob", "move europe 1")
+				s.ExpectWinner("alice")
+				s.ExpectOver("alice", true)
+				s.ExpectOver("bob", true)
+				if err := s.Try("alice", "move asia 1"); err == nil {
+					s.fail(fmt.Errorf("expected moving after the game ended to fail"))
+				}
+			},
+		},
+		{
+			Name:    "time-limit",
+			Options: Options{Players: []string{"alice", "bob"}, Seed: 1, Victory: "time:10m"},
+			Script: func(s *Sim) {
+				s.Do("alice", "spawn europe artillery")
+				s.Do("bob", "spawn australia infantry")
+				s.Advance(9 * time.Minute)
+				s.ExpectOver("alice", false)
+				s.Advance(time.Minute)
+				s.ExpectOver("alice", true)
+				s.ExpectWinner("alice")
+			},
+		},
+		{
+			Name:    "dice-wars-replay",
+			Options: Options{Players: []string{"alice", "bob"}, Seed: 42, Combat: "dice"},
+			Script: func(s *Sim) {
+				war := func(s *Sim) {
+					s.Do("alice", "spawn europe infantry")
+					s.Do("alice", "spawn europe cavalry")
+					s.Do("alice", "spawn europe artillery")
+					s.Do("bob", "spawn asia infantry")
+					s.Do("bob", "spawn asia infantry")
+					s.Do("bob", "spawn asia cavalry")
+					s.Do("bob", "move europe 1 2 3")
+				}
+				war(s)
+				first := s.LastWarResult()
+
+				again, err := New(s.Options())
+				if err != nil {
+					s.fail(err)
+					return
+				}
+				defer again.Close()
+				war(again)
+				second := again.LastWarResult()
+				if err := again.Err(); err != nil {
+					s.fail(fmt.Errorf("replay: %w", err))
+					return
+				}
+				s.expect(reflect.DeepEqual(first, second), "the same war result on replay, got %+v and %+v", first, second)
+			},
+		},
+	}
+}
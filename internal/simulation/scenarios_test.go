@@ -0,0 +1,19 @@
+package simulation
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestScenarios(t *testing.T) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for _, sc := range Scenarios() {
+		t.Run(sc.Name, func(t *testing.T) {
+			err := sc.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+// Package simulation runs whole games in a single process: every player gets
+// a GameState and a session wired to an in-memory bus, the referee runs
+// alongside them, and time only passes when the script says so. Given the
+// same seed a script always ends in the same state, which makes
+// multi-player scenarios easy to check.
+package simulation
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/client"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/membus"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/pubsub"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/referee"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/routing"
+)
+
+// SettleTimeout is how long Settle waits for the bus to go quiet.
+const SettleTimeout = 5 * time.Second
+
+type Options struct {
+	Players []string
+	// Seed seeds every player's war rolls. Player i uses Seed+i.
+	Seed int64
+	// Combat names the combat resolver, see gamelogic.NewCombatResolver.
+	Combat string
+	// Victory is a victory condition spec for the referee, see
+	// gamelogic.ParseVictoryConditions. Empty means the game never ends.
+	Victory string
+	// Output, if set, receives every player's events as JSON lines.
+	Output io.Writer
+}
+
+// Sim is a running simulation. Its methods stop doing anything once one of
+// them has failed, so a script can run to the end and check Err once.
+type Sim struct {
+	Clock    *Clock
+	Referee  *referee.Referee
+	bus      *membus.Bus
+	events   *recorder
+	sessions map[string]*client.Session
+	// presented holds the events shown to each player.
+	presented map[string][]gamelogic.Event
+	opts      Options
+	logs      []routing.GameLog
+	err       error
+	mu        *sync.Mutex
+}
+
+func New(opts Options) (*Sim, error) {
+	if len(opts.Players) == 0 {
+		return nil, errors.New("error: a simulation needs at least one player")
+	}
+	resolver, err := gamelogic.NewCombatResolver(opts.Combat)
+	if err != nil {
+		return nil, err
+	}
+	clock := NewClock(Epoch)
+	conditions, err := gamelogic.ParseVictoryConditions(opts.Victory, clock.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	bus := membus.New()
+	events := newRecorder(bus)
+	s := &Sim{
+		Clock:     clock,
+		bus:       bus,
+		events:    events,
+		opts:      opts,
+		sessions:  map[string]*client.Session{},
+		presented: map[string][]gamelogic.Event{},
+		mu:        &sync.Mutex{},
+	}
+	s.Referee = referee.New(events, conditions, s.writeLog)
+	s.Referee.SetClock(clock.Now)
+	s.Referee.SetOutput(io.Discard)
+	err = s.Referee.Subscribe(bus)
+	if err != nil {
+		bus.Close()
+		return nil, err
+	}
+
+	for i, username := range opts.Players {
+		if _, ok := s.sessions[username]; ok {
+			bus.Close()
+			return nil, fmt.Errorf("error: %s is playing twice", username)
+		}
+		gs := gamelogic.NewGameState(username)
+		gs.SetCombatResolver(resolver)
+		gs.SetSeed(opts.Seed + int64(i))
+		gs.SetClock(clock.Now)
+		gs.SetPresenter(s.presenter(username))
+		session := client.NewSessionWith(events, bus, gs)
+		err := session.Subscribe()
+		if err != nil {
+			bus.Close()
+			return nil, err
+		}
+		s.sessions[username] = session
+	}
+	return s, nil
+}
+
+// Options returns the options the simulation was created with, so that a
+// script can replay itself in a fresh simulation.
+func (s *Sim) Options() Options {
+	return s.opts
+}
+
+func (s *Sim) Close() error {
+	return s.bus.Close()
+}
+
+// Err returns the first error hit by the simulation, if any.
+func (s *Sim) Err() error {
+	return s.err
+}
+
+func (s *Sim) fail(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// Player returns the game state of a player, or nil if there is no such
+// player.
+func (s *Sim) Player(username string) *gamelogic.GameState {
+	session, ok := s.sessions[username]
+	if !ok {
+		s.fail(fmt.Errorf("error: %s is not playing", username))
+		return nil
+	}
+	return session.GameState
+}
+
+// Do runs a command as if the player had typed it, then waits for every
+// message it caused to be handled. A command that the game refuses fails
+// the simulation; use Try when that is expected.
+func (s *Sim) Do(username, line string) {
+	if s.err != nil {
+		return
+	}
+	err := s.Try(username, line)
+	if err != nil {
+		s.fail(fmt.Errorf("%s: %s: %w", username, line, err))
+	}
+}
+
+// Try runs a command like Do but returns the error instead of failing the
+// simulation.
+func (s *Sim) Try(username, line string) error {
+	if s.err != nil {
+		return s.err
+	}
+	session, ok := s.sessions[username]
+	if !ok {
+		return fmt.Errorf("error: %s is not playing", username)
+	}
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return errors.New("error: empty command")
+	}
+	var err error
+	switch words[0] {
+	case "move":
+		err = session.Move(words)
+	case "spawn":
+		err = session.Spawn(words)
+	case "propose", "accept", "break":
+		err = session.Diplomacy(words)
+	default:
+		err = fmt.Errorf("error: %s is not a command the simulation can run", words[0])
+	}
+	if err != nil {
+		return err
+	}
+	s.Settle()
+	return nil
+}
+
+// Pause and Resume do what the server's pause and resume commands do.
+func (s *Sim) Pause() {
+	s.publishPlayingState(true)
+}
+
+func (s *Sim) Resume() {
+	s.publishPlayingState(false)
+}
+
+func (s *Sim) publishPlayingState(paused bool) {
+	if s.err != nil {
+		return
+	}
+	err := pubsub.PublishJSON(s.events, routing.ExchangePerilDirect, routing.PauseKey, routing.PlayingState{
+		IsPaused: paused,
+	})
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	s.Settle()
+}
+
+// Publish sends a message to the topic exchange the way a client would, so
+// that a script can play one that misbehaves.
+func (s *Sim) Publish(key string, v any) {
+	s.publishTo(routing.ExchangePerilTopic, key, v)
+}
+
+// publishTo is Publish for either exchange.
+func (s *Sim) publishTo(exchange, key string, v any) {
+	if s.err != nil {
+		return
+	}
+	err := pubsub.PublishJSON(s.events, exchange, key, v)
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	s.Settle()
+}
+
+// Kick does what the admin API's kick endpoint does.
+func (s *Sim) Kick(username, reason string) {
+	if s.err != nil {
+		return
+	}
+	_, err := s.Referee.Kick(username, reason)
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	s.Settle()
+}
+
+// Advance moves the virtual clock forward and lets the referee check its
+// time limits.
+func (s *Sim) Advance(d time.Duration) {
+	if s.err != nil {
+		return
+	}
+	s.Referee.Check(s.Clock.Advance(d))
+	s.Settle()
+}
+
+// Settle waits until every queue is empty and every delivery has been
+// acknowledged. Handlers publish before they ack, so once the bus is idle
+// nothing else can happen until the script acts again.
+func (s *Sim) Settle() {
+	if s.err != nil {
+		return
+	}
+	deadline := time.Now().Add(SettleTimeout)
+	for !s.bus.Idle() {
+		if time.Now().After(deadline) {
+			s.fail(fmt.Errorf("error: messages still in flight after %v", SettleTimeout))
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Events returns the messages published so far whose routing key is prefix
+// or starts with prefix and a dot, such as routing.WarResultsPrefix.
+func (s *Sim) Events(prefix string) []Event {
+	return s.events.matching(prefix)
+}
+
+// Logs returns the game logs the referee wrote.
+func (s *Sim) Logs() []routing.GameLog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]routing.GameLog{}, s.logs...)
+}
+
+// Presented returns the events shown to a player so far.
+func (s *Sim) Presented(username string) []gamelogic.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]gamelogic.Event{}, s.presented[username]...)
+}
+
+func (s *Sim) presenter(username string) gamelogic.Presenter {
+	var out gamelogic.Presenter = gamelogic.Discard
+	if s.opts.Output != nil {
+		out = gamelogic.NewJSONLinesPresenter(s.opts.Output, username)
+	}
+	return gamelogic.PresenterFunc(func(e gamelogic.Event) {
+		s.mu.Lock()
+		s.presented[username] = append(s.presented[username], e)
+		s.mu.Unlock()
+		out.Present(e)
+	})
+}
+
+func (s *Sim) writeLog(gl routing.GameLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs = append(s.logs, gl)
+	return nil
+}
@@ -0,0 +1,61 @@
+// Package tracing sets up OpenTelemetry for a Peril binary. Trace context
+// is carried between binaries in message headers by pubsub, so a move, the
+// war it starts and the game log the war ends with all belong to one trace,
+// whichever clients and servers handled them.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Setup exports the spans of service to dest, which is stdout or a file
+// that spans are appended to, one JSON object per span. An empty dest
+// turns tracing off. The returned function flushes any spans not yet
+// written and should be called before the program exits.
+func Setup(service, dest string) (func(context.Context) error, error) {
+	if dest == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var out io.Writer = os.Stdout
+	var file *os.File
+	if dest != "stdout" {
+		var err error
+		file, err = os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("could not open trace file: %v", err)
+		}
+		out = file
+	}
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(out))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", service),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			file.Close()
+		}
+		return err
+	}, nil
+}
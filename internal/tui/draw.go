@@ -0,0 +1,194 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"golang.org/x/term"
+)
+
+const (
+	bold    = "\x1b[1m"
+	reverse = "\x1b[7m"
+	reset   = "\x1b[0m"
+)
+
+// cell is one line of a pane.
+type cell struct {
+	text  string
+	style string
+}
+
+// redraw draws the whole screen. The caller must hold the lock.
+func (ui *UI) redraw() {
+	if !ui.running {
+		return
+	}
+	width, height, err := term.GetSize(ui.fd)
+	if err != nil || width < 20 || height < 5 {
+		width, height = 80, 24
+	}
+	status := ui.gs.Status()
+	body := height - 2
+	leftWidth := min(44, width/2)
+	rightWidth := width - leftWidth - 1
+
+	left := ui.leftPane(status, body)
+	right := ui.feedPane(rightWidth, body)
+
+	b := &strings.Builder{}
+	b.WriteString("\x1b[H")
+	writeCell(b, cell{text: title(status), style: reverse}, width)
+	for i := range body {
+		b.WriteString("\r\n")
+		writeCell(b, left[i], leftWidth)
+		b.WriteString("│")
+		writeCell(b, right[i], rightWidth)
+	}
+
+	// Show the end of the input if it does not fit.
+	input := ui.input
+	if len(input) > width-3 {
+		input = input[len(input)-(width-3):]
+	}
+	b.WriteString("\r\n")
+	writeCell(b, cell{text: "> " + string(input)}, width)
+	fmt.Fprintf(b, "\x1b[%d;%dH", height, len(input)+3)
+	io.WriteString(ui.out, b.String())
+}
+
+func title(status gamelogic.Status) string {
+	state := "RUNNING"
+	if status.Over {
+		state = "GAME OVER"
+	} else if status.Paused {
+		state = "PAUSED"
+	}
+	return fmt.Sprintf(" Peril | %s | %d unit(s) | %s", status.Player.Username, len(status.Player.Units), state)
+}
+
+// leftPane lists every location with who is known to be there, then the
+// player's units and the most recent wars.
+func (ui *UI) leftPane(status gamelogic.Status, height int) []cell {
+	own := map[gamelogic.Location]int{}
+	units := []gamelogic.Unit{}
+	for _, unit := range status.Player.Units {
+		own[unit.Location]++
+		units = append(units, unit)
+	}
+	sort.Slice(units, func(i, j int) bool {
+		return units[i].ID < units[j].ID
+	})
+	enemies := map[gamelogic.Location]map[string]int{}
+	for _, s := range status.Sightings {
+		if enemies[s.Unit.Location] == nil {
+			enemies[s.Unit.Location] = map[string]int{}
+		}
+		enemies[s.Unit.Location][s.Username]++
+	}
+
+	cells := []cell{{text: " World", style: bold}}
+	for _, loc := range gamelogic.ListLocations() {
+		parts := []string{}
+		if own[loc] > 0 {
+			parts = append(parts, fmt.Sprintf("you:%d", own[loc]))
+		}
+		names := []string{}
+		for username := range enemies[loc] {
+			names = append(names, username)
+		}
+		sort.Strings(names)
+		for _, username := range names {
+			parts = append(parts, fmt.Sprintf("%s:%d", username, enemies[loc][username]))
+		}
+		style := ""
+		if own[loc] > 0 && len(names) > 0 {
+			style = bold
+		}
+		cells = append(cells, cell{text: fmt.Sprintf(" %-11s %s", loc, strings.Join(parts, " ")), style: style})
+	}
+
+	wars := []cell{{}, {text: " Wars", style: bold}}
+	recent := ui.wars
+	if len(recent) > 5 {
+		recent = recent[len(recent)-5:]
+	}
+	for _, war := range recent {
+		wars = append(wars, cell{text: " " + war})
+	}
+	if len(recent) == 0 {
+		wars = append(wars, cell{text: " none yet"})
+	}
+
+	cells = append(cells, cell{}, cell{text: " Your units", style: bold})
+	room := height - len(cells) - len(wars)
+	for i, unit := range units {
+		if i == room-1 && len(units) > room {
+			cells = append(cells, cell{text: fmt.Sprintf(" ... and %d more", len(units)-i)})
+			break
+		}
+		cells = append(cells, cell{text: fmt.Sprintf(" #%-3d %-10s %s", unit.ID, unit.Rank, unit.Location)})
+	}
+	for len(cells) < height-len(wars) {
+		cells = append(cells, cell{})
+	}
+	cells = append(cells, wars...)
+	return fit(cells, height)
+}
+
+// feedPane shows the end of the event feed, wrapping long lines.
+func (ui *UI) feedPane(width, height int) []cell {
+	lines := []cell{}
+	for i := len(ui.feed) - 1; i >= 0 && len(lines) < height-1; i-- {
+		wrapped := wrap(" "+ui.feed[i], width)
+		for j := len(wrapped) - 1; j >= 0; j-- {
+			lines = append(lines, cell{text: wrapped[j]})
+		}
+	}
+	cells := []cell{{text: " Events", style: bold}}
+	for i := len(lines) - 1; i >= 0; i-- {
+		cells = append(cells, lines[i])
+	}
+	if len(cells) > height {
+		cells = append(cells[:1], cells[len(cells)-height+1:]...)
+	}
+	return fit(cells, height)
+}
+
+// fit pads or cuts cells to exactly height lines.
+func fit(cells []cell, height int) []cell {
+	for len(cells) < height {
+		cells = append(cells, cell{})
+	}
+	return cells[:height]
+}
+
+func wrap(line string, width int) []string {
+	runes := []rune(line)
+	if width <= 4 || len(runes) <= width {
+		return []string{line}
+	}
+	lines := []string{}
+	for len(runes) > width {
+		lines = append(lines, string(runes[:width]))
+		runes = append([]rune("  "), runes[width:]...)
+	}
+	return append(lines, string(runes))
+}
+
+// writeCell writes text cut or padded to exactly width columns.
+func writeCell(b *strings.Builder, c cell, width int) {
+	runes := []rune(c.text)
+	if len(runes) > width {
+		runes = runes[:width]
+	}
+	b.WriteString(c.style)
+	b.WriteString(string(runes))
+	b.WriteString(strings.Repeat(" ", width-len(runes)))
+	if c.style != "" {
+		b.WriteString(reset)
+	}
+}
@@ -0,0 +1,305 @@
+// Package tui is a full-screen terminal interface for a player: a map of
+// where their units and the enemy's last known units are, a live feed of
+// game events, recent wars, the pause status and a command line.
+package tui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/console"
+	"github.com/bootdotdev/learn-pub-sub-starter/internal/gamelogic"
+	"golang.org/x/term"
+)
+
+const (
+	maxFeed = 500
+	maxWars = 50
+)
+
+// UI draws the whole screen again whenever something changes. It is a
+// gamelogic.Presenter, so events appear as soon as the handlers fire, and
+// an io.Writer for feedback on commands.
+type UI struct {
+	gs       *gamelogic.GameState
+	complete console.Completer
+	feed     []string
+	wars     []string
+	input    []rune
+	history  []string
+	// browsing is how far back in the history the up arrow has gone,
+	// where 0 means the player is typing a new line.
+	browsing int
+	running  bool
+	fd       int
+	out      io.Writer
+	mu       *sync.Mutex
+}
+
+// New creates the interface for a player. complete may be nil.
+func New(gs *gamelogic.GameState, complete console.Completer) *UI {
+	return &UI{
+		gs:       gs,
+		complete: complete,
+		fd:       int(os.Stdin.Fd()),
+		out:      os.Stdout,
+		mu:       &sync.Mutex{},
+	}
+}
+
+func (ui *UI) Present(e gamelogic.Event) {
+	lines, war := describe(e)
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	ui.addFeed(lines...)
+	if war != "" {
+		ui.wars = appendBounded(ui.wars, maxWars, war)
+	}
+	ui.redraw()
+}
+
+// Write adds text to the event feed, one entry per line.
+func (ui *UI) Write(p []byte) (int, error) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	ui.addFeed(strings.Split(strings.TrimRight(string(p), "\n"), "\n")...)
+	ui.redraw()
+	return len(p), nil
+}
+
+func (ui *UI) addFeed(lines ...string) {
+	stamp := ui.gs.Now().Format("15:04:05") + " "
+	for _, line := range lines {
+		ui.feed = appendBounded(ui.feed, maxFeed, stamp+line)
+		stamp = strings.Repeat(" ", len(stamp))
+	}
+}
+
+// Run takes over the terminal and hands every line the player enters to
+// run until run returns true or the player presses Ctrl-C or Ctrl-D. The
+// terminal is restored before Run returns.
+func (ui *UI) Run(run func(line string) bool) error {
+	if !term.IsTerminal(ui.fd) {
+		return errors.New("error: the full-screen interface needs a terminal")
+	}
+	state, err := term.MakeRaw(ui.fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(ui.fd, state)
+	io.WriteString(ui.out, "\x1b[?1049h")
+	defer io.WriteString(ui.out, "\x1b[?1049l")
+
+	ui.mu.Lock()
+	ui.running = true
+	ui.redraw()
+	ui.mu.Unlock()
+	defer func() {
+		ui.mu.Lock()
+		ui.running = false
+		ui.mu.Unlock()
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	go ui.watchSize(done)
+
+	keys := bufio.NewReader(os.Stdin)
+	for {
+		key, _, err := keys.ReadRune()
+		if err != nil {
+			return nil
+		}
+		line, entered, quit := ui.handleKey(key, keys)
+		if quit {
+			return nil
+		}
+		if entered && strings.TrimSpace(line) != "" && run(line) {
+			return nil
+		}
+	}
+}
+
+// handleKey edits the command line and reports the line once the player
+// presses enter.
+func (ui *UI) handleKey(key rune, keys *bufio.Reader) (line string, entered bool, quit bool) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	defer ui.redraw()
+	switch key {
+	case 3, 4: // Ctrl-C, Ctrl-D
+		return "", false, true
+	case '\r', '\n':
+		line = string(ui.input)
+		ui.input = nil
+		ui.browsing = 0
+		if strings.TrimSpace(line) != "" {
+			ui.history = appendBounded(ui.history, maxFeed, line)
+		}
+		return line, true, false
+	case 127, 8: // backspace
+		if len(ui.input) > 0 {
+			ui.input = ui.input[:len(ui.input)-1]
+		}
+	case 21: // Ctrl-U
+		ui.input = nil
+	case '\t':
+		if ui.complete == nil {
+			break
+		}
+		completed, matches := console.Complete(ui.complete, string(ui.input))
+		ui.input = []rune(completed)
+		if len(matches) > 1 {
+			ui.addFeed(strings.Join(matches, "  "))
+		}
+	case 27: // escape sequences, of which only the arrows mean anything
+		// The rest of a sequence arrives with the escape, so an escape
+		// with nothing after it was the key on its own and is ignored
+		// rather than waiting for, and eating, the next key.
+		if keys.Buffered() == 0 {
+			break
+		}
+		if next, _, _ := keys.ReadRune(); next != '[' || keys.Buffered() == 0 {
+			break
+		}
+		arrow, _, _ := keys.ReadRune()
+		switch arrow {
+		case 'A':
+			ui.browse(1)
+		case 'B':
+			ui.browse(-1)
+		}
+	default:
+		if unicode.IsPrint(key) {
+			ui.input = append(ui.input, key)
+		}
+	}
+	return "", false, false
+}
+
+func (ui *UI) browse(step int) {
+	pos := ui.browsing + step
+	if pos < 0 || pos > len(ui.history) {
+		return
+	}
+	ui.browsing = pos
+	if pos == 0 {
+		ui.input = nil
+		return
+	}
+	ui.input = []rune(ui.history[len(ui.history)-pos])
+}
+
+// watchSize redraws the screen when the terminal is resized.
+func (ui *UI) watchSize(done <-chan struct{}) {
+	width, height, _ := term.GetSize(ui.fd)
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		w, h, err := term.GetSize(ui.fd)
+		if err != nil || (w == width && h == height) {
+			continue
+		}
+		width, height = w, h
+		ui.mu.Lock()
+		ui.redraw()
+		ui.mu.Unlock()
+	}
+}
+
+func appendBounded(lines []string, max int, line string) []string {
+	lines = append(lines, line)
+	if len(lines) > max {
+		lines = lines[len(lines)-max:]
+	}
+	return lines
+}
+
+// describe summarises an event for the feed, and for the war pane when it
+// is about a war the player fought.
+func describe(e gamelogic.Event) (lines []string, war string) {
+	switch e := e.(type) {
+	case gamelogic.Paused:
+		if e.Paused {
+			return []string{"The game is paused."}, ""
+		}
+		return []string{"The game has resumed."}, ""
+	case gamelogic.MoveDetected:
+		if e.Outcome == gamelogic.MoveOutcomeSamePlayer {
+			return nil, ""
+		}
+		line := fmt.Sprintf("%s moved %d unit(s) to %s", e.Move.Username, len(e.Move.Units), e.Move.ToLocation)
+		switch {
+		case e.Outcome == gamelogic.MoveOutcomeMakeWar && e.Pact != "":
+			line += fmt.Sprintf(", breaking your %s, war!", e.Pact)
+		case e.Outcome == gamelogic.MoveOutcomeMakeWar:
+			line += ", war!"
+		case e.Pact != "":
+			line += fmt.Sprintf(", kept at peace by your %s", e.Pact)
+		}
+		return []string{line}, ""
+	case gamelogic.Moved:
+		return []string{fmt.Sprintf("You moved %d unit(s) to %s", len(e.Move.Units), e.Move.ToLocation)}, ""
+	case gamelogic.Spawned:
+		return []string{fmt.Sprintf("You spawned a(n) %s in %s with id %d", e.Unit.Rank, e.Unit.Location, e.Unit.ID)}, ""
+	case gamelogic.WarFought:
+		switch e.Outcome {
+		case gamelogic.WarOutcomeNotInvolved:
+			return nil, ""
+		case gamelogic.WarOutcomeNoUnits:
+			return []string{fmt.Sprintf("Your war with %s was called off, no units met", e.Defender)}, ""
+		case gamelogic.WarOutcomePact:
+			return []string{fmt.Sprintf("Your war with %s was called off by your %s", e.Defender, e.Pact)}, ""
+		}
+		war = describeWar(e.Result)
+		lines = []string{"War! " + war}
+		if len(e.Casualties) > 0 {
+			lines = append(lines, fmt.Sprintf("You lost %d unit(s)", len(e.Casualties)))
+		}
+		return lines, war
+	case gamelogic.WarResultReceived:
+		war = describeWar(e.Result)
+		lines = []string{fmt.Sprintf("%s attacked you! %s", e.Result.Attacker, war)}
+		if len(e.Result.DefenderCasualties) > 0 {
+			lines = append(lines, fmt.Sprintf("You lost %d unit(s)", len(e.Result.DefenderCasualties)))
+		}
+		return lines, war
+	case gamelogic.ChatReceived:
+		return []string{fmt.Sprintf("[%s] %s: %s", gamelogic.ChatLabel(e.Message), e.Message.From, e.Message.Text)}, ""
+	}
+
+	// Everything else reads fine as the plain text client shows it, minus
+	// the banners.
+	buf := &strings.Builder{}
+	gamelogic.NewTextPresenter(buf).Present(e)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line == "" || strings.HasPrefix(line, "====") || strings.HasPrefix(line, "----") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, ""
+}
+
+func describeWar(wr gamelogic.WarResult) string {
+	if wr.Draw {
+		return fmt.Sprintf("%s: %s and %s drew %d-%d", wr.Location, wr.Attacker, wr.Defender, wr.AttackerPower, wr.DefenderPower)
+	}
+	winnerPower, loserPower := wr.AttackerPower, wr.DefenderPower
+	if wr.Winner == wr.Defender {
+		winnerPower, loserPower = loserPower, winnerPower
+	}
+	return fmt.Sprintf("%s: %s beat %s %d-%d", wr.Location, wr.Winner, wr.Loser, winnerPower, loserPower)
+}
@@ -23,9 +23,16 @@ cleanup() {
 # Setup trap for SIGINT
 trap 'cleanup' SIGINT
 
-# Start the specified number of instances of the program in the background
+# Start the specified number of instances of the program in the background.
+# Only the first instance referees the game, the rest just consume game logs
+# and chat. They share those queues, so each enforces its share of the
+# per-player rate limits, and sends kicks and strikes to the referee.
 for (( i=0; i<num_instances; i++ )); do
-  go run ./cmd/server &
+  if [ "$i" -eq 0 ]; then
+    go run ./cmd/server -servers "$num_instances" &
+  else
+    go run ./cmd/server -referee=false -servers "$num_instances" &
+  fi
   pids+=($!)
 done
 